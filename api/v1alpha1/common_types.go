@@ -16,14 +16,105 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Condition types of SdewanStatus
+const (
+	// the CR is in sync with all the pods of the CNF: every pod is ready, and has the CR
+	// applied with a confirmed service action
+	ConditionReady = "Ready"
+	// the last apply to the ready pods of the CNF succeeded, even if some pods are not ready
+	ConditionApplied = "Applied"
+	// the CR is applied to some pods of the CNF but failed on the others
+	ConditionDegraded = "Degraded"
+	// the changes to the CNF are paused by the sdewan.akraino.org/paused annotation
+	ConditionPaused = "Paused"
+)
+
+// SdewanCondition has the same fields as metav1.Condition, which is not
+// available in the k8s.io/apimachinery version used by the operator
+type SdewanCondition struct {
+	// +kubebuilder:validation:Pattern=`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])$`
+	Type string `json:"type"`
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// +optional
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	Reason             string      `json:"reason"`
+	Message            string      `json:"message"`
+}
+
+// SdewanPodStatus is the apply status of a CR on one CNF pod
+type SdewanPodStatus struct {
+	Name string `json:"name"`
+	// +optional
+	IP string `json:"ip,omitempty"`
+	// The UID and the container restarts of the pod the CR was last applied to.
+	// A failed apply is only retried on the other pods while the key is unchanged.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// The resourceVersion of the CR last applied to the pod
+	// +optional
+	AppliedVersion string `json:"appliedVersion,omitempty"`
+	// The generation of the CR last applied to the pod
+	// +optional
+	AppliedGeneration int64 `json:"appliedGeneration,omitempty"`
+	// The service action (reload or restart) which applied the last change to the pod
+	// +optional
+	ServiceAction string `json:"serviceAction,omitempty"`
+	// The error of the last apply, empty if it succeeded
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// The generation of the CR which failed the health check and was reverted on the pod.
+	// It is not applied to the pod again until the spec changes.
+	// +optional
+	RevertedGeneration int64 `json:"revertedGeneration,omitempty"`
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// Plan actions of SdewanPodPlan
+const (
+	PlanActionNone   = "none"
+	PlanActionCreate = "create"
+	PlanActionUpdate = "update"
+	PlanActionDelete = "delete"
+)
+
+// SdewanPodPlan is the change a dry run would make to one CNF pod
+type SdewanPodPlan struct {
+	Pod string `json:"pod"`
+	// +kubebuilder:validation:Enum=none;create;update;delete
+	Action string `json:"action"`
+	// The changed fields of the runtime object, secrets are not shown
+	// +optional
+	Diff []string `json:"diff,omitempty"`
+}
+
 // status subsource used for Sdewan rule CRDs
 type SdewanStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	AppliedVersion string       `json:"appliedVersion"`
-	AppliedTime    *metav1.Time `json:"appliedTime"`
-	InSync         bool         `json:"inSync"`
+	// +optional
+	AppliedVersion string `json:"appliedVersion,omitempty"`
+	// +optional
+	AppliedTime *metav1.Time `json:"appliedTime,omitempty"`
+	InSync      bool         `json:"inSync"`
+	// The generation of the CR last applied. Unlike the resourceVersion, it doesn't change with the status.
+	// +optional
+	AppliedGeneration int64 `json:"appliedGeneration,omitempty"`
+	// The last time the runtime config of the CNF was found different from the CR and repaired
+	// +optional
+	LastDriftTime *metav1.Time `json:"lastDriftTime,omitempty"`
+	// +optional
+	Conditions []SdewanCondition `json:"conditions,omitempty"`
+	// The apply status on each ready pod of the CNF
+	// +optional
+	Pods []SdewanPodStatus `json:"pods,omitempty"`
+	// The changes computed by the last dry run, nothing is applied to the CNF in dry run
+	// +optional
+	Plan []SdewanPodPlan `json:"plan,omitempty"`
 }
@@ -0,0 +1,75 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FirewallDNATSpec defines the desired state of FirewallDNAT
+type FirewallDNATSpec struct {
+	// Name of the FirewallZone CR the incoming traffic comes from
+	// +kubebuilder:validation:MinLength=1
+	Src string `json:"src"`
+	// +kubebuilder:validation:Pattern=`^((25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])(/(3[0-2]|[12]?[0-9]))?$`
+	SrcIp string `json:"src_ip,omitempty"`
+	// External IP address the traffic is destined to
+	// +kubebuilder:validation:Format=ipv4
+	SrcDIp string `json:"src_dip,omitempty"`
+	// +kubebuilder:validation:Pattern=`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`
+	SrcMac string `json:"src_mac,omitempty"`
+	// +kubebuilder:validation:Pattern=`^(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3})(-(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3}))?$`
+	SrcPort string `json:"src_port,omitempty"`
+	// External port the traffic is destined to
+	// +kubebuilder:validation:Pattern=`^(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3})(-(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3}))?$`
+	SrcDPort string `json:"src_dport,omitempty"`
+	// +kubebuilder:validation:Enum=tcp;udp;tcpudp;icmp;all
+	Proto string `json:"proto,omitempty"`
+	// Name of the FirewallZone CR the traffic is forwarded to
+	Dest string `json:"dest,omitempty"`
+	// Internal IP address the traffic is forwarded to
+	// +kubebuilder:validation:Format=ipv4
+	DestIp string `json:"dest_ip"`
+	// +kubebuilder:validation:Pattern=`^(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3})(-(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3}))?$`
+	DestPort string `json:"dest_port,omitempty"`
+	// +kubebuilder:validation:Pattern=`^!?(0x)?[0-9a-fA-F]+(/(0x)?[0-9a-fA-F]+)?$`
+	Mark string `json:"mark,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// FirewallDNAT is the Schema for the firewalldnats API
+type FirewallDNAT struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FirewallDNATSpec `json:"spec,omitempty"`
+	Status SdewanStatus     `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// FirewallDNATList contains a list of FirewallDNAT
+type FirewallDNATList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FirewallDNAT `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FirewallDNAT{}, &FirewallDNATList{})
+}
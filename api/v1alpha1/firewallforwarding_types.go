@@ -0,0 +1,57 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FirewallForwardingSpec defines the desired state of FirewallForwarding
+type FirewallForwardingSpec struct {
+	// Name of the source FirewallZone CR
+	// +kubebuilder:validation:MinLength=1
+	Src string `json:"src"`
+	// Name of the destination FirewallZone CR
+	// +kubebuilder:validation:MinLength=1
+	Dest string `json:"dest"`
+	// +kubebuilder:validation:Enum=ipv4;ipv6;any
+	Family string `json:"family,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// FirewallForwarding is the Schema for the firewallforwardings API
+type FirewallForwarding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FirewallForwardingSpec `json:"spec,omitempty"`
+	Status SdewanStatus           `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// FirewallForwardingList contains a list of FirewallForwarding
+type FirewallForwardingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FirewallForwarding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FirewallForwarding{}, &FirewallForwardingList{})
+}
@@ -0,0 +1,74 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FirewallSNATSpec defines the desired state of FirewallSNAT
+type FirewallSNATSpec struct {
+	// Name of the FirewallZone CR the outgoing traffic comes from
+	Src string `json:"src,omitempty"`
+	// +kubebuilder:validation:Pattern=`^((25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])(/(3[0-2]|[12]?[0-9]))?$`
+	SrcIp string `json:"src_ip,omitempty"`
+	// IP address the source address is rewritten to
+	// +kubebuilder:validation:Format=ipv4
+	SrcDIp string `json:"src_dip"`
+	// +kubebuilder:validation:Pattern=`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`
+	SrcMac string `json:"src_mac,omitempty"`
+	// +kubebuilder:validation:Pattern=`^(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3})(-(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3}))?$`
+	SrcPort string `json:"src_port,omitempty"`
+	// Port the source port is rewritten to
+	// +kubebuilder:validation:Pattern=`^(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3})(-(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3}))?$`
+	SrcDPort string `json:"src_dport,omitempty"`
+	// +kubebuilder:validation:Enum=tcp;udp;tcpudp;icmp;all
+	Proto string `json:"proto,omitempty"`
+	// Name of the FirewallZone CR the outgoing traffic leaves through
+	// +kubebuilder:validation:MinLength=1
+	Dest string `json:"dest"`
+	// +kubebuilder:validation:Pattern=`^((25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])(/(3[0-2]|[12]?[0-9]))?$`
+	DestIp string `json:"dest_ip,omitempty"`
+	// +kubebuilder:validation:Pattern=`^(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3})(-(6553[0-5]|655[0-2][0-9]|65[0-4][0-9]{2}|6[0-4][0-9]{3}|[1-5][0-9]{4}|[1-9][0-9]{0,3}))?$`
+	DestPort string `json:"dest_port,omitempty"`
+	// +kubebuilder:validation:Pattern=`^!?(0x)?[0-9a-fA-F]+(/(0x)?[0-9a-fA-F]+)?$`
+	Mark string `json:"mark,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// FirewallSNAT is the Schema for the firewallsnats API
+type FirewallSNAT struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FirewallSNATSpec `json:"spec,omitempty"`
+	Status SdewanStatus     `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// FirewallSNATList contains a list of FirewallSNAT
+type FirewallSNATList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FirewallSNAT `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FirewallSNAT{}, &FirewallSNATList{})
+}
@@ -0,0 +1,68 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FirewallZoneSpec defines the desired state of FirewallZone
+type FirewallZoneSpec struct {
+	// Network names as listed in the nfn-network annotation of the CNF Deployment
+	Network []string `json:"network"`
+	// +kubebuilder:validation:Enum="0";"1"
+	Masq     string   `json:"masq,omitempty"`
+	MasqSrc  []string `json:"masq_src,omitempty"`
+	MasqDest []string `json:"masq_dest,omitempty"`
+	// +kubebuilder:validation:Enum="0";"1"
+	MasqAllowInvalid string `json:"masq_allow_invalid,omitempty"`
+	// +kubebuilder:validation:Enum="0";"1"
+	MtuFix string `json:"mtu_fix,omitempty"`
+	// +kubebuilder:validation:Enum=ACCEPT;REJECT;DROP
+	Input string `json:"input,omitempty"`
+	// +kubebuilder:validation:Enum=ACCEPT;REJECT;DROP
+	Forward string `json:"forward,omitempty"`
+	// +kubebuilder:validation:Enum=ACCEPT;REJECT;DROP
+	Output string `json:"output,omitempty"`
+	// +kubebuilder:validation:Enum=ipv4;ipv6;any
+	Family string   `json:"family,omitempty"`
+	Subnet []string `json:"subnet,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// FirewallZone is the Schema for the firewallzones API
+type FirewallZone struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FirewallZoneSpec `json:"spec,omitempty"`
+	Status SdewanStatus     `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// FirewallZoneList contains a list of FirewallZone
+type FirewallZoneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FirewallZone `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FirewallZone{}, &FirewallZoneList{})
+}
@@ -0,0 +1,77 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IpsecHostSpec defines the desired state of IpsecHost
+type IpsecHostSpec struct {
+	// responder: the CNF accepts tunnels from dynamic peers and assigns them virtual IPs.
+	// initiator: the CNF connects to a hub and requests a virtual IP from it.
+	// +kubebuilder:validation:Enum=responder;initiator
+	Role string `json:"role"`
+	// Address of the hub, required by initiator
+	Remote string `json:"remote,omitempty"`
+	// Pool of virtual IPs assigned to the peers, required by responder
+	// +kubebuilder:validation:Pattern=`^([0-9]{1,3}\.){3}[0-9]{1,3}/[0-9]{1,2}$`
+	VirtualIpPool string `json:"virtual_ip_pool,omitempty"`
+	// Subnet behind the CNF which is reachable through the tunnel
+	LocalSubnet string `json:"local_subnet,omitempty"`
+	// Subnet behind the hub which is reachable through the tunnel
+	RemoteSubnet string `json:"remote_subnet,omitempty"`
+	// +kubebuilder:validation:Enum=psk;pubkey
+	AuthenticationMethod string `json:"authentication_method"`
+	// Secret key holding the pre-shared key, used by psk authentication
+	PreSharedKey     *corev1.SecretKeySelector `json:"pre_shared_key,omitempty"`
+	LocalIdentifier  string                    `json:"local_identifier,omitempty"`
+	RemoteIdentifier string                    `json:"remote_identifier,omitempty"`
+	// Names of the IpsecProposal CRs used for both the IKE SA and the child SA
+	CryptoProposal []string `json:"crypto_proposal,omitempty"`
+	// +kubebuilder:validation:Enum="0";"1"
+	ForceCryptoProposal string `json:"force_crypto_proposal,omitempty"`
+	// Secret keys holding the certificates, used by pubkey authentication
+	LocalPublicCert  *corev1.SecretKeySelector `json:"local_public_cert,omitempty"`
+	LocalPrivateCert *corev1.SecretKeySelector `json:"local_private_cert,omitempty"`
+	SharedCa         *corev1.SecretKeySelector `json:"shared_ca,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// IpsecHost is the Schema for the ipsechosts API
+type IpsecHost struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IpsecHostSpec `json:"spec,omitempty"`
+	Status SdewanStatus  `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IpsecHostList contains a list of IpsecHost
+type IpsecHostList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IpsecHost `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IpsecHost{}, &IpsecHostList{})
+}
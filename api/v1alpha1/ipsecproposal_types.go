@@ -0,0 +1,56 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IpsecProposalSpec defines the desired state of IpsecProposal.
+// The algorithms are the strongSwan keywords accepted by the CNF.
+type IpsecProposalSpec struct {
+	// +kubebuilder:validation:Enum="3des";aes128;aes192;aes256;aes128ctr;aes192ctr;aes256ctr;aes128ccm16;aes192ccm16;aes256ccm16;aes128gcm16;aes192gcm16;aes256gcm16;camellia128;camellia192;camellia256;chacha20poly1305
+	EncryptionAlgorithm string `json:"encryption_algorithm"`
+	// +kubebuilder:validation:Enum=md5;sha1;sha256;sha384;sha512;aesxcbc;aescmac
+	HashAlgorithm string `json:"hash_algorithm"`
+	// +kubebuilder:validation:Enum=modp768;modp1024;modp1536;modp2048;modp3072;modp4096;modp6144;modp8192;modp1024s160;modp2048s224;modp2048s256;ecp192;ecp224;ecp256;ecp384;ecp521;ecp224bp;ecp256bp;ecp384bp;ecp512bp;curve25519;curve448
+	DhGroup string `json:"dh_group"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// IpsecProposal is the Schema for the ipsecproposals API
+type IpsecProposal struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IpsecProposalSpec `json:"spec,omitempty"`
+	Status SdewanStatus      `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IpsecProposalList contains a list of IpsecProposal
+type IpsecProposalList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IpsecProposal `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IpsecProposal{}, &IpsecProposalList{})
+}
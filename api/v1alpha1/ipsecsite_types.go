@@ -0,0 +1,86 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IpsecConnection defines a child SA of an ipsec tunnel
+type IpsecConnection struct {
+	Name string `json:"name"`
+	// +kubebuilder:validation:Enum=tunnel;transport
+	Type string `json:"type,omitempty"`
+	// +kubebuilder:validation:Enum=start;add;route
+	Mode           string `json:"mode,omitempty"`
+	LocalSubnet    string `json:"local_subnet,omitempty"`
+	LocalNat       string `json:"local_nat,omitempty"`
+	LocalSourceip  string `json:"local_sourceip,omitempty"`
+	LocalUpdown    string `json:"local_updown,omitempty"`
+	LocalFirewall  string `json:"local_firewall,omitempty"`
+	RemoteSubnet   string `json:"remote_subnet,omitempty"`
+	RemoteSourceip string `json:"remote_sourceip,omitempty"`
+	RemoteUpdown   string `json:"remote_updown,omitempty"`
+	RemoteFirewall string `json:"remote_firewall,omitempty"`
+	// Names of the IpsecProposal CRs used for the child SA
+	CryptoProposal []string `json:"crypto_proposal,omitempty"`
+}
+
+// IpsecSiteSpec defines the desired state of IpsecSite
+type IpsecSiteSpec struct {
+	Gateway string `json:"gateway"`
+	// +kubebuilder:validation:Enum=psk;pubkey
+	AuthenticationMethod string `json:"authentication_method"`
+	// Secret key holding the pre-shared key, used by psk authentication
+	PreSharedKey     *corev1.SecretKeySelector `json:"pre_shared_key,omitempty"`
+	LocalIdentifier  string                    `json:"local_identifier,omitempty"`
+	RemoteIdentifier string                    `json:"remote_identifier,omitempty"`
+	// Names of the IpsecProposal CRs used for the IKE SA
+	CryptoProposal []string `json:"crypto_proposal,omitempty"`
+	// +kubebuilder:validation:Enum="0";"1"
+	ForceCryptoProposal string `json:"force_crypto_proposal,omitempty"`
+	// Secret keys holding the certificates, used by pubkey authentication
+	LocalPublicCert  *corev1.SecretKeySelector `json:"local_public_cert,omitempty"`
+	LocalPrivateCert *corev1.SecretKeySelector `json:"local_private_cert,omitempty"`
+	SharedCa         *corev1.SecretKeySelector `json:"shared_ca,omitempty"`
+	Connections      []IpsecConnection         `json:"connections,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// IpsecSite is the Schema for the ipsecsites API
+type IpsecSite struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IpsecSiteSpec `json:"spec,omitempty"`
+	Status SdewanStatus  `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IpsecSiteList contains a list of IpsecSite
+type IpsecSiteList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IpsecSite `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IpsecSite{}, &IpsecSiteList{})
+}
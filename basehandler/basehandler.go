@@ -0,0 +1,48 @@
+package basehandler
+
+import (
+	"context"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sdewan.akraino.org/sdewan/openwrt"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ISdewanHandler is implemented by every CR kind which is applied to the CNF.
+// It converts the CR to openwrt object and calls the openwrt APIs for the kind.
+type ISdewanHandler interface {
+	GetType() string
+	// GetName returns the CNF object name of the CR, which has the prefix of GetObjectPrefix
+	GetName(instance runtime.Object) string
+	GetObjectPrefix() string
+	GetFinalizer() string
+	GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error)
+	Convert(r client.Client, o runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error)
+	IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool
+	GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error)
+	CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error)
+	UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error)
+	DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error
+	// ListObjectNames returns the names of all the CNF objects of the handler type, including the ones not owned by the operator
+	ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error)
+	// CheckHealth checks the service of a pod after the object is applied and read back by a Rolling
+	// or Canary rollout. It returns nil if the service has no status to check.
+	CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error
+	// GetServiceName returns the openwrt service which applies the CNF objects
+	GetServiceName() string
+	// GetServiceActions returns the service actions which apply the changes of the CNF objects.
+	// The least disruptive one supported by the CNF is used.
+	GetServiceActions() []string
+	ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error)
+}
+
+// ILegacyHandler is implemented by the handlers of the kinds whose CNF objects were named after
+// the CR before the prefix was introduced. When the object with the prefix is created, the legacy
+// object is deleted only if it is the one the operator wrote, so a built-in object with the name
+// of a CR is never touched.
+type ILegacyHandler interface {
+	// IsLegacyObject checks if legacy is the object the operator wrote for instance, without the prefixes
+	IsLegacyObject(legacy openwrt.IOpenWrtObject, instance openwrt.IOpenWrtObject) bool
+}
@@ -0,0 +1,143 @@
+package cnfprovider
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"sdewan.akraino.org/sdewan/basehandler"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+// BatchWindow is how long a service action waits for more changes. The changes to the same
+// service of a pod share one action, which runs once no change came in for BatchWindow.
+var BatchWindow = time.Second
+
+// BatchMaxDelay bounds how long a stream of changes can delay the action of a pod service
+var BatchMaxDelay = 10 * time.Second
+
+// a service action shared by the changes to a pod service
+type serviceBatch struct {
+	done  chan struct{}
+	timer *time.Timer
+	first time.Time
+	// the handler of the first change, which runs the action for all of them
+	handler    basehandler.ISdewanHandler
+	clientInfo *openwrt.OpenwrtClientInfo
+	changes    int
+	// the most disruptive action required by the changes
+	action string
+	err    error
+	// called with the result of the action, for the changes which didn't wait for it
+	onDone []func(error)
+}
+
+type serviceBatcher struct {
+	mu      sync.Mutex
+	pending map[string]*serviceBatch
+	// the pod services whose last action failed, so that the next reconcile runs it again
+	failed map[string]bool
+}
+
+var batcher = newServiceBatcher()
+
+func newServiceBatcher() *serviceBatcher {
+	return &serviceBatcher{pending: map[string]*serviceBatch{}, failed: map[string]bool{}}
+}
+
+func batchKey(clientInfo *openwrt.OpenwrtClientInfo, service string) string {
+	return clientInfo.Ip + "/" + service
+}
+
+// add adds a change to the pending batch of the handler service on a pod. The action of the
+// batch is delayed by BatchWindow from the last change, up to BatchMaxDelay from the first one.
+func (b *serviceBatcher) add(cnf string, capabilities openwrt.ServiceCapabilities, handler basehandler.ISdewanHandler, clientInfo *openwrt.OpenwrtClientInfo, onDone func(error)) (*serviceBatch, error) {
+	service := handler.GetServiceName()
+	action, err := capabilities.SelectAction(service, handler.GetServiceActions())
+	if err != nil {
+		return nil, err
+	}
+	key := batchKey(clientInfo, service)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &serviceBatch{done: make(chan struct{}), first: time.Now(), handler: handler, clientInfo: clientInfo, action: action}
+		b.pending[key] = batch
+		batch.timer = time.AfterFunc(BatchWindow, func() {
+			b.flush(cnf, key, batch)
+		})
+	} else {
+		if openwrt.CompareServiceActions(action, batch.action) > 0 {
+			batch.action = action
+		}
+		// a fired timer is waiting for the lock to flush the batch, which includes this change
+		if time.Since(batch.first)+BatchWindow <= BatchMaxDelay && batch.timer.Stop() {
+			batch.timer.Reset(BatchWindow)
+		}
+	}
+	batch.changes++
+	if onDone != nil {
+		batch.onDone = append(batch.onDone, onDone)
+	}
+	return batch, nil
+}
+
+func (b *serviceBatcher) flush(cnf string, key string, batch *serviceBatch) {
+	// changes from now on start a new batch
+	b.mu.Lock()
+	delete(b.pending, key)
+	changes := batch.changes
+	action := batch.action
+	b.mu.Unlock()
+	// the action is shared by the changes of several CRs, so it has its own timeout
+	ctx, cancel := context.WithTimeout(context.Background(), PodTimeout)
+	defer cancel()
+	_, err := batch.handler.ExecuteService(ctx, batch.clientInfo, action)
+	recordServiceAction(cnf, batch.handler.GetServiceName(), action, changes, err)
+	b.mu.Lock()
+	if err != nil {
+		b.failed[key] = true
+	} else {
+		delete(b.failed, key)
+	}
+	b.mu.Unlock()
+	batch.err = err
+	close(batch.done)
+	for _, onDone := range batch.onDone {
+		onDone(err)
+	}
+}
+
+// execute adds a change and waits for the batched action, and returns the action used and its result
+func (b *serviceBatcher) execute(ctx context.Context, cnf string, capabilities openwrt.ServiceCapabilities, handler basehandler.ISdewanHandler, clientInfo *openwrt.OpenwrtClientInfo) (string, error) {
+	batch, err := b.add(cnf, capabilities, handler, clientInfo, nil)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case <-batch.done:
+		return batch.action, batch.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// schedule adds a change without waiting for the batched action, and returns the action
+// required by the change. onDone is called with the result of the action.
+func (b *serviceBatcher) schedule(cnf string, capabilities openwrt.ServiceCapabilities, handler basehandler.ISdewanHandler, clientInfo *openwrt.OpenwrtClientInfo, onDone func(error)) (string, error) {
+	batch, err := b.add(cnf, capabilities, handler, clientInfo, onDone)
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return batch.action, nil
+}
+
+// needsAction checks if the last action of the handler service on a pod failed
+func (b *serviceBatcher) needsAction(handler basehandler.ISdewanHandler, clientInfo *openwrt.OpenwrtClientInfo) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failed[batchKey(clientInfo, handler.GetServiceName())]
+}
@@ -0,0 +1,276 @@
+package cnfprovider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"sdewan.akraino.org/sdewan/basehandler"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+// fakeServiceHandler records the service actions executed on the pods
+type fakeServiceHandler struct {
+	basehandler.ISdewanHandler
+	actions []string
+	// the actions fail with err, only the first failures ones if failures > 0
+	err      error
+	failures int
+
+	mu       sync.Mutex
+	executed []string
+}
+
+func (h *fakeServiceHandler) GetServiceName() string {
+	return "mwan3"
+}
+
+func (h *fakeServiceHandler) GetServiceActions() []string {
+	return h.actions
+}
+
+func (h *fakeServiceHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.executed = append(h.executed, clientInfo.Ip+"/"+action)
+	if h.failures > 0 && len(h.executed) > h.failures {
+		return true, nil
+	}
+	return h.err == nil, h.err
+}
+
+func (h *fakeServiceHandler) getExecuted() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.executed...)
+}
+
+func setBatchWindow(t *testing.T, window time.Duration, maxDelay time.Duration) {
+	oldWindow, oldMaxDelay := BatchWindow, BatchMaxDelay
+	BatchWindow, BatchMaxDelay = window, maxDelay
+	t.Cleanup(func() {
+		BatchWindow, BatchMaxDelay = oldWindow, oldMaxDelay
+	})
+}
+
+var reloadOnly = []string{openwrt.ServiceActionReload}
+
+// staticCapabilities reports the default actions of the services, without asking the pod
+func staticCapabilities(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) (openwrt.ServiceCapabilities, error) {
+	return openwrt.DefaultServiceCapabilities, nil
+}
+
+func TestBatchCoalescesChanges(t *testing.T) {
+	setBatchWindow(t, 100*time.Millisecond, 5*time.Second)
+	pod1 := &openwrt.OpenwrtClientInfo{Ip: "10.0.0.1"}
+	pod2 := &openwrt.OpenwrtClientInfo{Ip: "10.0.0.2"}
+	tests := []struct {
+		name string
+		// the changes, in order, each of them with the pod and the actions of its handler
+		pods     []*openwrt.OpenwrtClientInfo
+		actions  [][]string
+		interval time.Duration
+		want     []string
+	}{
+		{
+			name:     "sequential changes share one action",
+			pods:     repeatPod(pod1, 30),
+			actions:  repeatActions(reloadOnly, 30),
+			interval: 10 * time.Millisecond,
+			want:     []string{"10.0.0.1/reload"},
+		},
+		{
+			name:     "the most disruptive action is used",
+			pods:     []*openwrt.OpenwrtClientInfo{pod1, pod1, pod1},
+			actions:  [][]string{reloadOnly, {openwrt.ServiceActionRestart}, reloadOnly},
+			interval: 10 * time.Millisecond,
+			want:     []string{"10.0.0.1/restart"},
+		},
+		{
+			name:     "pods have their own actions",
+			pods:     []*openwrt.OpenwrtClientInfo{pod1, pod2, pod1, pod2},
+			actions:  repeatActions(reloadOnly, 4),
+			interval: 10 * time.Millisecond,
+			want:     []string{"10.0.0.1/reload", "10.0.0.2/reload"},
+		},
+		{
+			name:     "changes after the window start a new action",
+			pods:     []*openwrt.OpenwrtClientInfo{pod1, pod1},
+			actions:  repeatActions(reloadOnly, 2),
+			interval: 300 * time.Millisecond,
+			want:     []string{"10.0.0.1/reload", "10.0.0.1/reload"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newServiceBatcher()
+			executor := &fakeServiceHandler{}
+			for i, pod := range tt.pods {
+				if i > 0 {
+					time.Sleep(tt.interval)
+				}
+				handler := &executingHandler{&fakeServiceHandler{actions: tt.actions[i]}, executor}
+				if _, err := b.schedule("cnf", openwrt.DefaultServiceCapabilities, handler, pod, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			time.Sleep(3 * BatchWindow)
+			got := executor.getExecuted()
+			if !sameStrings(got, tt.want) {
+				t.Errorf("got actions %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchExecuteWaitsForSharedAction(t *testing.T) {
+	setBatchWindow(t, 50*time.Millisecond, 5*time.Second)
+	b := newServiceBatcher()
+	handler := &fakeServiceHandler{actions: reloadOnly}
+	pod := &openwrt.OpenwrtClientInfo{Ip: "10.0.0.1"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			action, err := b.execute(context.Background(), "cnf", openwrt.DefaultServiceCapabilities, handler, pod)
+			if err != nil || action != openwrt.ServiceActionReload {
+				t.Errorf("got %s, %v, want reload", action, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := handler.getExecuted(); len(got) != 1 {
+		t.Errorf("got actions %v, want 1 action", got)
+	}
+}
+
+func TestBatchMaxDelay(t *testing.T) {
+	setBatchWindow(t, 100*time.Millisecond, 300*time.Millisecond)
+	b := newServiceBatcher()
+	handler := &fakeServiceHandler{actions: reloadOnly}
+	pod := &openwrt.OpenwrtClientInfo{Ip: "10.0.0.1"}
+	start := time.Now()
+	for time.Since(start) < 600*time.Millisecond {
+		if _, err := b.schedule("cnf", openwrt.DefaultServiceCapabilities, handler, pod, nil); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// a change every 20ms never leaves the window quiet, only the max delay flushes the batches
+	if got := handler.getExecuted(); len(got) < 1 || len(got) > 3 {
+		t.Errorf("got actions %v, want 1 to 3 actions", got)
+	}
+}
+
+func TestBatchFailure(t *testing.T) {
+	setBatchWindow(t, 50*time.Millisecond, 5*time.Second)
+	b := newServiceBatcher()
+	handler := &fakeServiceHandler{actions: reloadOnly, err: errors.New("reload failed")}
+	pod := &openwrt.OpenwrtClientInfo{Ip: "10.0.0.1"}
+	var mu sync.Mutex
+	failures := 0
+	onDone := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures++
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := b.schedule("cnf", openwrt.DefaultServiceCapabilities, handler, pod, onDone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(4 * BatchWindow)
+	mu.Lock()
+	if failures != 3 {
+		t.Errorf("got %d failure callbacks, want 3", failures)
+	}
+	mu.Unlock()
+	if !b.needsAction(handler, pod) {
+		t.Error("the failed action is not run again by the next reconcile")
+	}
+
+	handler.err = nil
+	if _, err := b.execute(context.Background(), "cnf", openwrt.DefaultServiceCapabilities, handler, pod); err != nil {
+		t.Fatal(err)
+	}
+	if b.needsAction(handler, pod) {
+		t.Error("the action is still needed after it succeeded")
+	}
+}
+
+// executingHandler has its own service actions, but records the executed ones in executor,
+// so that the actions of the changes by different handlers are recorded together
+type executingHandler struct {
+	*fakeServiceHandler
+	executor *fakeServiceHandler
+}
+
+func (h *executingHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	return h.executor.ExecuteService(ctx, clientInfo, action)
+}
+
+func repeatPod(pod *openwrt.OpenwrtClientInfo, n int) []*openwrt.OpenwrtClientInfo {
+	pods := make([]*openwrt.OpenwrtClientInfo, n)
+	for i := range pods {
+		pods[i] = pod
+	}
+	return pods
+}
+
+func repeatActions(actions []string, n int) [][]string {
+	list := make([][]string, n)
+	for i := range list {
+		list[i] = actions
+	}
+	return list
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := map[string]int{}
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		count[s]--
+		if count[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestProviderUsesPodCapabilities(t *testing.T) {
+	setBatchWindow(t, 10*time.Millisecond, time.Second)
+	restartOnly := func(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) (openwrt.ServiceCapabilities, error) {
+		return openwrt.ServiceCapabilities{"mwan3": {openwrt.ServiceActionRestart}}, nil
+	}
+	tests := []struct {
+		name      string
+		overrides openwrt.ServiceCapabilities
+		want      string
+	}{
+		{name: "reported by the pod", want: openwrt.ServiceActionRestart},
+		{name: "overridden by the annotation", overrides: openwrt.ServiceCapabilities{"mwan3": {openwrt.ServiceActionReload}}, want: openwrt.ServiceActionReload},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &fakeServiceHandler{actions: []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}}
+			p := &OpenWrtProvider{GetCapabilities: restartOnly, CapabilityOverrides: test.overrides}
+			action, err := p.executeService(context.Background(), handler, &openwrt.OpenwrtClientInfo{Ip: "10.0.2.1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action != test.want {
+				t.Errorf("got action %s, want %s", action, test.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,39 @@
 package cnfprovider
 
 import (
-	sdewanv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"context"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/basehandler"
 )
 
+// PodResult is the result of applying a CR to one cnf pod
+type PodResult struct {
+	Name    string
+	Ip      string
+	Changed bool
+	// the service action which applied the change
+	Action string
+	Err    error
+	// the key of the pod when the CR was applied, see PodKey
+	Key string
+	// the service action of the change is scheduled, and its result is not known yet
+	Pending bool
+	// the change failed the health check and was reverted, or it is held as it was reverted before
+	Reverted bool
+}
+
 type CnfProvider interface {
-	AddUpdateMwan3Policy(*sdewanv1alpha1.Mwan3Policy) error
-	DeleteMwan3Policy(*sdewanv1alpha1.Mwan3Policy) error
+	// AddOrUpdateObject applies the CR to the ready pods of the cnf. skipPods are the keys of the
+	// pods the CR is applied to already, which are reported as successful without any call.
+	// revertedPods are the names of the pods the CR was reverted on, which fail without any call.
+	AddOrUpdateObject(ctx context.Context, handler basehandler.ISdewanHandler, instance runtime.Object, skipPods []string, revertedPods []string) (bool, []PodResult, error)
+	DeleteObject(ctx context.Context, handler basehandler.ISdewanHandler, instance runtime.Object) (bool, []PodResult, error)
+	// PlanObject computes the changes of AddOrUpdateObject, or DeleteObject if isDelete, without applying them
+	PlanObject(ctx context.Context, handler basehandler.ISdewanHandler, instance runtime.Object, isDelete bool) ([]batchv1alpha1.SdewanPodPlan, error)
+	// DeleteOrphanObjects deletes the CNF objects with the handler prefix which are not returned by getNames.
+	// getNames is called after the objects are listed from a pod, so that a CR created meanwhile is never missed.
+	DeleteOrphanObjects(ctx context.Context, handler basehandler.ISdewanHandler, getNames func() ([]string, error)) (bool, []PodResult, error)
 	// TODO: Add more Interfaces here
 	IsCnfReady() (bool, error)
 }
@@ -0,0 +1,57 @@
+package cnfprovider
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sdewan.akraino.org/sdewan/openwrt"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The annotation of the cnf deployment with the name of the Secret holding the LuCI credentials
+// in the username and password keys. Without it, the cnf is accessed as root with no password.
+const credentialsAnnotation = "sdewan.akraino.org/credentials-secret"
+
+const (
+	defaultUser       = "root"
+	secretUserKey     = "username"
+	secretPasswordKey = "password"
+)
+
+// getCredentials reads the LuCI credentials of the cnf. The Secret is read for every provider,
+// and the controllers watch it, so a rotated password is used right away.
+func getCredentials(k8sClient client.Client, deployment extensionsv1beta1.Deployment) (string, string, error) {
+	name, ok := deployment.Annotations[credentialsAnnotation]
+	if !ok {
+		return defaultUser, "", nil
+	}
+	secret := &corev1.Secret{}
+	err := k8sClient.Get(context.Background(), types.NamespacedName{Namespace: deployment.Namespace, Name: name}, secret)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get credentials secret %s: %v", name, err)
+	}
+	password, ok := secret.Data[secretPasswordKey]
+	if !ok {
+		return "", "", fmt.Errorf("No key %s in credentials secret %s", secretPasswordKey, name)
+	}
+	user := defaultUser
+	if value, ok := secret.Data[secretUserKey]; ok {
+		user = string(value)
+	}
+	return user, string(password), nil
+}
+
+// getClientInfo returns the client info to access a pod of the cnf
+func (p *OpenWrtProvider) getClientInfo(pod *corev1.Pod) *openwrt.OpenwrtClientInfo {
+	return &openwrt.OpenwrtClientInfo{
+		Ip:       pod.Status.PodIP,
+		User:     p.User,
+		Password: p.Password,
+		Scheme:   p.Scheme,
+		Port:     p.Port,
+		TLS:      p.TLS,
+	}
+}
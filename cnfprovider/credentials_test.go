@@ -0,0 +1,95 @@
+package cnfprovider
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sdewan.akraino.org/sdewan/openwrt"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetCredentials(t *testing.T) {
+	objects := []runtime.Object{
+		newSecret("admin", map[string]string{"username": "admin", "password": "secret"}),
+		newSecret("root", map[string]string{"password": "secret"}),
+		newSecret("no-password", map[string]string{"username": "admin"}),
+	}
+	tests := []struct {
+		name         string
+		secret       string
+		wantUser     string
+		wantPassword string
+		wantErr      bool
+	}{
+		{name: "no annotation", wantUser: "root"},
+		{name: "user and password", secret: "admin", wantUser: "admin", wantPassword: "secret"},
+		{name: "default user", secret: "root", wantUser: "root", wantPassword: "secret"},
+		{name: "no password", secret: "no-password", wantErr: true},
+		{name: "no secret", secret: "missing", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			annotations := map[string]string{}
+			if test.secret != "" {
+				annotations[credentialsAnnotation] = test.secret
+			}
+			user, password, err := getCredentials(fake.NewFakeClient(objects...), newCnfDeployment(annotations))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if user != test.wantUser || password != test.wantPassword {
+				t.Errorf("got %s/%s, want %s/%s", user, password, test.wantUser, test.wantPassword)
+			}
+		})
+	}
+}
+
+func TestClientChangesWithCredentials(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: "10.0.3.2"}}
+	base := &OpenWrtProvider{User: "root", Password: "secret"}
+	tests := []struct {
+		name       string
+		provider   OpenWrtProvider
+		wantChange bool
+	}{
+		{name: "same credentials", provider: OpenWrtProvider{User: "root", Password: "secret"}},
+		{name: "rotated password", provider: OpenWrtProvider{User: "root", Password: "rotated"}, wantChange: true},
+		{name: "other user", provider: OpenWrtProvider{User: "admin", Password: "secret"}, wantChange: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := openwrt.GetOpenwrtClient(*base.getClientInfo(pod))
+			if changed := openwrt.GetOpenwrtClient(*test.provider.getClientInfo(pod)) != old; changed != test.wantChange {
+				t.Errorf("got a new client %v, want %v", changed, test.wantChange)
+			}
+		})
+	}
+}
+
+func TestReferencedObjects(t *testing.T) {
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		wantSecrets    []string
+		wantConfigMaps []string
+	}{
+		{name: "no annotation"},
+		{name: "credentials", annotations: map[string]string{credentialsAnnotation: "admin"}, wantSecrets: []string{"admin"}},
+		{name: "transport", annotations: map[string]string{transportAnnotation: `{"scheme": "https", "caConfigMap": "ca", "clientCertSecret": "client"}`},
+			wantSecrets: []string{"client"}, wantConfigMaps: []string{"ca"}},
+		{name: "credentials and transport", annotations: map[string]string{
+			credentialsAnnotation: "admin", transportAnnotation: `{"scheme": "https", "caSecret": "ca", "clientCertSecret": "client"}`},
+			wantSecrets: []string{"admin", "ca", "client"}},
+		{name: "invalid transport", annotations: map[string]string{credentialsAnnotation: "admin", transportAnnotation: `{"scheme": `},
+			wantSecrets: []string{"admin"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secrets, configMaps := ReferencedObjects(newCnfDeployment(test.annotations))
+			if !sameStrings(secrets, test.wantSecrets) || !sameStrings(configMaps, test.wantConfigMaps) {
+				t.Errorf("got secrets %v and configmaps %v, want %v and %v", secrets, configMaps, test.wantSecrets, test.wantConfigMaps)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package cnfprovider
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	serviceActions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sdewan_cnf_service_actions_total",
+			Help: "Number of openwrt service actions (reload, restart) on the cnf pods",
+		},
+		[]string{"cnf", "service", "action", "result"},
+	)
+	serviceChanges = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sdewan_cnf_service_changes_total",
+			Help: "Number of changes applied to the cnf pods by the openwrt service actions",
+		},
+		[]string{"cnf", "service"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(serviceActions, serviceChanges)
+}
+
+func recordServiceAction(cnf string, service string, action string, changes int, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	serviceActions.WithLabelValues(cnf, service, action, result).Inc()
+	serviceChanges.WithLabelValues(cnf, service).Add(float64(changes))
+}
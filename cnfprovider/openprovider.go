@@ -2,11 +2,19 @@ package cnfprovider
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
-	"reflect"
-	"sdewan.akraino.org/sdewan/controllers"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sdewan.akraino.org/sdewan/basehandler"
 	"sdewan.akraino.org/sdewan/openwrt"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -19,121 +27,512 @@ type OpenWrtProvider struct {
 	SdewanPurpose string
 	Deployment    extensionsv1beta1.Deployment
 	K8sClient     client.Client
+	// the actions of the services set by the service-actions annotation, which override the
+	// ones reported by the pods
+	CapabilityOverrides openwrt.ServiceCapabilities
+	// gets the actions supported by the services of a pod
+	GetCapabilities func(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) (openwrt.ServiceCapabilities, error)
+	// how the CRs are applied to the pods of the cnf
+	Rollout RolloutStrategy
+	// the LuCI credentials of the cnf
+	User     string
+	Password string
+	// the scheme, port and TLS setting to access the cnf
+	Scheme string
+	Port   int
+	TLS    *openwrt.TLSConfig
+	// called with the result of a service action which the changes don't wait for
+	OnServiceAction func(error)
 }
 
+// PodWorkers is the max number of cnf pods a CR is applied to at the same time
+var PodWorkers = 4
+
+// PodTimeout is the timeout to apply a CR to one cnf pod
+var PodTimeout = 30 * time.Second
+
+// The annotation of the cnf deployment to override the actions supported by the services,
+// e.g. {"mwan3": ["restart"]} if the cnf can't reload mwan3
+const serviceActionsAnnotation = "sdewan.akraino.org/service-actions"
+
 func NewOpenWrt(namespace string, sdewanPurpose string, k8sClient client.Client) (*OpenWrtProvider, error) {
 	reqLogger := log.WithValues("namespace", namespace, "sdewanPurpose", sdewanPurpose)
 	ctx := context.Background()
 	deployments := &extensionsv1beta1.DeploymentList{}
-	err := k8sClient.List(ctx, deployments, client.MatchingLabels{"sdewanPurpose": sdewanPurpose})
+	err := k8sClient.List(ctx, deployments, client.InNamespace(namespace), client.MatchingLabels{"sdewanPurpose": sdewanPurpose})
 	if err != nil {
 		reqLogger.Error(err, "Failed to get cnf deployment")
 		return nil, client.IgnoreNotFound(err)
 	}
+	if len(deployments.Items) == 0 {
+		// no cnf exists
+		return nil, nil
+	}
 	if len(deployments.Items) != 1 {
 		reqLogger.Error(nil, "More than one deployment exists")
 		return nil, errors.New("More than one deployment exists")
 	}
 
-	return &OpenWrtProvider{namespace, sdewanPurpose, deployments.Items[0], k8sClient}, nil
+	deployment := deployments.Items[0]
+	overrides, err := getCapabilityOverrides(deployment)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get service capabilities")
+		return nil, err
+	}
+	rollout, err := getRolloutStrategy(deployment)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get rollout strategy")
+		return nil, err
+	}
+	user, password, err := getCredentials(k8sClient, deployment)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get cnf credentials")
+		return nil, err
+	}
+	scheme, port, tlsConfig, err := getTransport(k8sClient, deployment)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get cnf transport")
+		return nil, err
+	}
+	return &OpenWrtProvider{namespace, sdewanPurpose, deployment, k8sClient, overrides, getPodCapabilities, rollout, user, password, scheme, port, tlsConfig, nil}, nil
+}
+
+func getCapabilityOverrides(deployment extensionsv1beta1.Deployment) (openwrt.ServiceCapabilities, error) {
+	value, ok := deployment.Annotations[serviceActionsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	overrides := openwrt.ServiceCapabilities{}
+	err := json.Unmarshal([]byte(value), &overrides)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid annotation %s: %v", serviceActionsAnnotation, err)
+	}
+	return overrides, nil
+}
+
+// getPodCapabilities asks a pod for the actions supported by its services, see ServiceClient.GetServiceCapabilities
+func getPodCapabilities(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) (openwrt.ServiceCapabilities, error) {
+	service := openwrt.ServiceClient{OpenwrtClient: openwrt.GetOpenwrtClient(*clientInfo)}
+	return service.GetServiceCapabilities(ctx)
+}
+
+// getCapabilities returns the actions supported by the services of a pod, with the overrides of the annotation
+func (p *OpenWrtProvider) getCapabilities(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) (openwrt.ServiceCapabilities, error) {
+	capabilities := openwrt.ServiceCapabilities{}
+	if p.GetCapabilities != nil {
+		reported, err := p.GetCapabilities(ctx, clientInfo)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get the service actions: %w", err)
+		}
+		for service, actions := range reported {
+			capabilities[service] = actions
+		}
+	}
+	for service, actions := range p.CapabilityOverrides {
+		capabilities[service] = actions
+	}
+	return capabilities, nil
+}
+
+// executeService adds a change to the batched service action of a pod, and waits for the action
+func (p *OpenWrtProvider) executeService(ctx context.Context, handler basehandler.ISdewanHandler, clientInfo *openwrt.OpenwrtClientInfo) (string, error) {
+	capabilities, err := p.getCapabilities(ctx, clientInfo)
+	if err != nil {
+		return "", err
+	}
+	return batcher.execute(ctx, p.Deployment.Name, capabilities, handler, clientInfo)
+}
+
+// scheduleService adds a change to the batched service action of a pod without waiting for it
+func (p *OpenWrtProvider) scheduleService(ctx context.Context, handler basehandler.ISdewanHandler, clientInfo *openwrt.OpenwrtClientInfo, onDone func(error)) (string, error) {
+	capabilities, err := p.getCapabilities(ctx, clientInfo)
+	if err != nil {
+		return "", err
+	}
+	return batcher.schedule(p.Deployment.Name, capabilities, handler, clientInfo, onDone)
+}
+
+// IsPodReady checks the Ready condition of a cnf pod
+func IsPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (p *OpenWrtProvider) IsCnfReady() (bool, error) {
+	return p.Deployment.Status.ReadyReplicas > 0, nil
 }
 
-func (p *OpenWrtProvider) AddOrUpdateObject(handler ISdewanHandler, instance runtime.Object) (bool, error) {
+// PausedAnnotation set to "true" on a CR or a cnf Deployment stops the changes to the cnf
+const PausedAnnotation = "sdewan.akraino.org/paused"
+
+func (p *OpenWrtProvider) IsPaused() bool {
+	return p.Deployment.Annotations[PausedAnnotation] == "true"
+}
+
+// ErrChangeHeld is the error of a pod the change was reverted on, until the spec changes
+var ErrChangeHeld = errors.New("the change failed the health check and was reverted, so it's held until the spec changes")
+
+func (p *OpenWrtProvider) AddOrUpdateObject(ctx context.Context, handler basehandler.ISdewanHandler, instance runtime.Object, skipPods []string, revertedPods []string) (bool, []PodResult, error) {
 	// reqLogger := log.WithValues("Mwan3Policy", mwan3Policy.Name, "cnf", p.Deployment.Name)
 	reqLogger := log.WithValues(handler.GetType(), handler.GetName(instance), "cnf", p.Deployment.Name)
-	ctx := context.Background()
 	podList := &corev1.PodList{}
-	err := p.K8sClient.List(ctx, podList, client.MatchingLabels{"sdewanPurpose": p.SdewanPurpose})
+	err := p.K8sClient.List(ctx, podList, client.InNamespace(p.Namespace), client.MatchingLabels{"sdewanPurpose": p.SdewanPurpose})
 	if err != nil {
 		reqLogger.Error(err, "Failed to get cnf pod list")
-		return false, err
+		return false, nil, err
 	}
 	// policy, err := p.convertCrd(mwan3Policy)
-	new_instance, err := handler.Convert(instance)
+	new_instance, err := handler.Convert(p.K8sClient, instance, p.Deployment)
+	if err != nil {
+		reqLogger.Error(err, "Failed to convert CR for "+handler.GetType())
+		return false, nil, err
+	}
+	lastKnownGood, err := p.getLastKnownGood(handler, instance)
 	if err != nil {
-		reqLogger.Error(err, "Failed to convert CR for " + handler.GetType())
-		return false, err
+		// the restore falls back to delete the object
+		reqLogger.Error(err, "Failed to get the last known good object")
 	}
-	cnfChanged := false
-	for _, pod := range podList.Items {
+	results := p.rollout(ctx, readyPods(podList.Items), func(ctx context.Context, pod *corev1.Pod) PodResult {
+		if containsString(skipPods, PodKey(pod)) {
+			// the CR is applied to the pod already, only the failed pods are retried
+			return PodResult{Name: pod.Name, Ip: pod.Status.PodIP}
+		}
+		if containsString(revertedPods, pod.Name) {
+			// the rollout stops at the pod, as it would after applying the change again
+			return PodResult{Name: pod.Name, Ip: pod.Status.PodIP, Reverted: true, Err: ErrChangeHeld}
+		}
 		// openwrtClient := openwrt.GetOpenwrtClient(pod.Status.PodIP, "root", "")
 		// mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
 		// service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
-		// runtimePolicy, _ := mwan3.GetPolicy(policy.Name)
-		clientInfo := &openwrt.OpenwrtClientInfo{pod.Status.PodIP, "root", ""}
-		runtime_instance, _ := handler.GetObject(clientInfo, new_instance.GetName())
-		changed := false
-		// if runtimePolicy == nil {
-		if runtime_instance == nil {
-			// _, err := mwan3.CreatePolicy(*policy)
-			_, err := handler.CreateObject(clientInfo, new_instance)
-			if err != nil {
-				reqLogger.Error(err, "Failed to create " + handler.GetType())
-				return false, err
-			}
-			changed = true
+		clientInfo := p.getClientInfo(pod)
+		podLogger := reqLogger.WithValues("pod", pod.Name)
+		changed, action, previous, err := p.addOrUpdatePod(ctx, handler, new_instance, lastKnownGood, clientInfo, podLogger)
+		reverted := false
+		if err == nil && changed && p.Rollout.Type != RolloutAllAtOnce {
+			reverted, err = p.checkPod(ctx, handler, new_instance, previous, clientInfo, podLogger)
+		}
+		pending := changed && p.Rollout.Type == RolloutAllAtOnce
+		return PodResult{Name: pod.Name, Ip: pod.Status.PodIP, Changed: changed, Action: action, Err: err, Pending: pending, Reverted: reverted}
+	})
+	// We say the AddUpdate succeed only when the add/update for all pods succeed
+	return resultsChanged(results), results, resultsError(results)
+}
+
+// addOrUpdatePod applies the object to a pod, and returns the object to restore if the change
+// has to be reverted later: the runtime object before the change, or the last known good object
+// of the CR if the pod had no runtime object. A failed change is restored right away.
+func (p *OpenWrtProvider) addOrUpdatePod(ctx context.Context, handler basehandler.ISdewanHandler, new_instance openwrt.IOpenWrtObject, lastKnownGood openwrt.IOpenWrtObject, clientInfo *openwrt.OpenwrtClientInfo, reqLogger logr.Logger) (bool, string, openwrt.IOpenWrtObject, error) {
+	// runtimePolicy, _ := mwan3.GetPolicy(policy.Name)
+	runtime_instance, err := getRuntimeObject(ctx, handler, clientInfo, new_instance.GetName())
+	if err != nil {
+		reqLogger.Error(err, "Failed to get "+handler.GetType())
+		return false, "", nil, err
+	}
+	// snapshot of the runtime object before the change
+	snapshot := runtime_instance
+	if snapshot == nil {
+		snapshot = lastKnownGood
+	}
+	changed := false
+	// if runtimePolicy == nil {
+	if runtime_instance == nil {
+		// _, err := mwan3.CreatePolicy(*policy)
+		_, err := handler.CreateObject(ctx, clientInfo, new_instance)
+		if err != nil {
+			reqLogger.Error(err, "Failed to create "+handler.GetType())
+			return false, "", nil, p.restoreAfterFailure(ctx, handler, new_instance.GetName(), snapshot, clientInfo, err, reqLogger)
+		}
+		deleteLegacyObject(ctx, handler, new_instance, clientInfo, reqLogger)
+		changed = true
 		// } else if reflect.DeepEqual(*runtimePolicy, *policy) {
-		} else if handler.IsEqual(runtime_instance, new_instance) {
-			reqLogger.Info("Equal to the runtime instance, so no update")
-		} else {
-			// _, err := mwan3.UpdatePolicy(*policy)
-			_, err := handler.UpdateObject(clientInfo, new_instance)
-			if err != nil {
-				reqLogger.Error(err, "Failed to update " + handler.GetType())
-				return false, err
-			}
-			changed = true
+	} else if handler.IsEqual(runtime_instance, new_instance) {
+		reqLogger.Info("Equal to the runtime instance, so no update")
+	} else {
+		// _, err := mwan3.UpdatePolicy(*policy)
+		_, err := handler.UpdateObject(ctx, clientInfo, new_instance)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update "+handler.GetType())
+			return false, "", nil, p.restoreAfterFailure(ctx, handler, new_instance.GetName(), snapshot, clientInfo, err, reqLogger)
 		}
-		if changed {
-			// _, err = service.ExecuteService("mwan3", "restart")
-			_, err = handler.Restart(clientInfo)
-			if err != nil {
-				reqLogger.Error(err, "Failed to restart openwrt service")
-				return changed, err
+		changed = true
+	}
+	if !changed && !batcher.needsAction(handler, clientInfo) {
+		return false, "", nil, nil
+	}
+	if p.Rollout.Type == RolloutAllAtOnce {
+		// the service action is shared with the following changes, and a failed one restores the snapshot
+		action, err := p.scheduleService(ctx, handler, clientInfo, func(err error) {
+			if err == nil {
+				p.onServiceAction(nil)
+				return
 			}
-			cnfChanged = true
-		}
+			// the other changes of the batch are restored at the same time
+			go func() {
+				p.onServiceAction(p.restoreAfterServiceFailure(handler, new_instance, snapshot, clientInfo, err, reqLogger))
+			}()
+		})
+		return true, action, snapshot, err
+	}
+	// the pod is checked after the change, so wait for the service action
+	// _, err = service.ExecuteService("mwan3", "restart")
+	action, err := p.executeService(ctx, handler, clientInfo)
+	if err != nil {
+		reqLogger.Error(err, "Failed to execute openwrt service action", "action", action)
+		return true, action, nil, p.restoreAfterFailure(ctx, handler, new_instance.GetName(), snapshot, clientInfo, err, reqLogger)
+	}
+	return true, action, snapshot, nil
+}
+
+func (p *OpenWrtProvider) onServiceAction(err error) {
+	if p.OnServiceAction != nil {
+		p.OnServiceAction(err)
 	}
-	// We say the AddUpdate succeed only when the add/update for all pods succeed
-	return cnfChanged, nil
 }
 
-func (p *OpenWrtProvider) DeleteObject(handler ISdewanHandler, instance runtime.Object) (bool, error) {
+func (p *OpenWrtProvider) DeleteObject(ctx context.Context, handler basehandler.ISdewanHandler, instance runtime.Object) (bool, []PodResult, error) {
 	// reqLogger := log.WithValues("Mwan3Policy", mwan3Policy.Name, "cnf", p.Deployment.Name)
 	reqLogger := log.WithValues(handler.GetType(), handler.GetName(instance), "cnf", p.Deployment.Name)
-	ctx := context.Background()
 	podList := &corev1.PodList{}
-	err := p.K8sClient.List(ctx, podList, client.MatchingLabels{"sdewanPurpose": p.SdewanPurpose})
+	err := p.K8sClient.List(ctx, podList, client.InNamespace(p.Namespace), client.MatchingLabels{"sdewanPurpose": p.SdewanPurpose})
 	if err != nil {
 		reqLogger.Error(err, "Failed to get pod list")
-		return false, err
+		return false, nil, err
 	}
-	cnfChanged := false
-	for _, pod := range podList.Items {
+	results := p.forEachPod(ctx, readyPods(podList.Items), PodTimeout, func(ctx context.Context, pod *corev1.Pod) PodResult {
 		// openwrtClient := openwrt.NewOpenwrtClient(pod.Status.PodIP, "root", "")
 		// mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
 		// service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
-		clientInfo := &openwrt.OpenwrtClientInfo{pod.Status.PodIP, "root", ""}
-		runtime_instance, _ := handler.GetObject(clientInfo, handler.GetName(instance))
-		// runtimePolicy, _ := mwan3.GetPolicy(mwan3Policy.Name)
-		if runtime_instance == nil {
-			reqLogger.Info("Runtime instance doesn't exist, so don't have to delete")
-		} else {
-			// err = mwan3.DeletePolicy(mwan3Policy.Name)
-			err = handler.DeleteObject(clientInfo, handler.GetName(instance))
-			if err != nil {
-				reqLogger.Error(err, "Failed to delete instance")
-				return false, err
-			}
-			// _, err = service.ExecuteService("mwan3", "restart")
-			_, err = handler.Restart(clientInfo)
-			if err != nil {
-				reqLogger.Error(err, "Failed to restart openwrt service")
-				return false, err
-			}
-			cnfChanged = true
+		clientInfo := p.getClientInfo(pod)
+		changed, action, err := p.deletePod(ctx, handler, handler.GetName(instance), clientInfo, reqLogger.WithValues("pod", pod.Name))
+		return PodResult{Name: pod.Name, Ip: pod.Status.PodIP, Changed: changed, Action: action, Err: err}
+	})
+	// We say the deletioni succeed only when the deletion for all pods succeed
+	return resultsChanged(results), results, resultsError(results)
+}
+
+func (p *OpenWrtProvider) deletePod(ctx context.Context, handler basehandler.ISdewanHandler, name string, clientInfo *openwrt.OpenwrtClientInfo, reqLogger logr.Logger) (bool, string, error) {
+	runtime_instance, err := getRuntimeObject(ctx, handler, clientInfo, name)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get "+handler.GetType())
+		return false, "", err
+	}
+	// runtimePolicy, _ := mwan3.GetPolicy(mwan3Policy.Name)
+	if runtime_instance == nil {
+		reqLogger.Info("Runtime instance doesn't exist, so don't have to delete")
+		return false, "", nil
+	}
+	// err = mwan3.DeletePolicy(mwan3Policy.Name)
+	err = handler.DeleteObject(ctx, clientInfo, name)
+	if openwrt.IsNotFound(err) {
+		reqLogger.Info("Runtime instance is deleted already")
+		return false, "", nil
+	}
+	if err != nil {
+		reqLogger.Error(err, "Failed to delete instance")
+		return false, "", err
+	}
+	// _, err = service.ExecuteService("mwan3", "restart")
+	action, err := p.scheduleService(ctx, handler, clientInfo, p.onServiceAction)
+	if err != nil {
+		reqLogger.Error(err, "Failed to schedule openwrt service action")
+	}
+	return true, action, err
+}
+
+func (p *OpenWrtProvider) DeleteOrphanObjects(ctx context.Context, handler basehandler.ISdewanHandler, getNames func() ([]string, error)) (bool, []PodResult, error) {
+	reqLogger := log.WithValues("kind", handler.GetType(), "cnf", p.Deployment.Name)
+	podList := &corev1.PodList{}
+	err := p.K8sClient.List(ctx, podList, client.InNamespace(p.Namespace), client.MatchingLabels{"sdewanPurpose": p.SdewanPurpose})
+	if err != nil {
+		reqLogger.Error(err, "Failed to get pod list")
+		return false, nil, err
+	}
+	results := p.forEachPod(ctx, readyPods(podList.Items), PodTimeout, func(ctx context.Context, pod *corev1.Pod) PodResult {
+		clientInfo := p.getClientInfo(pod)
+		changed, action, err := p.deleteOrphanPod(ctx, handler, getNames, clientInfo, reqLogger.WithValues("pod", pod.Name))
+		return PodResult{Name: pod.Name, Ip: pod.Status.PodIP, Changed: changed, Action: action, Err: err}
+	})
+	return resultsChanged(results), results, resultsError(results)
+}
+
+func (p *OpenWrtProvider) deleteOrphanPod(ctx context.Context, handler basehandler.ISdewanHandler, getNames func() ([]string, error), clientInfo *openwrt.OpenwrtClientInfo, reqLogger logr.Logger) (bool, string, error) {
+	runtime_names, err := handler.ListObjectNames(ctx, clientInfo)
+	if err != nil {
+		reqLogger.Error(err, "Failed to list "+handler.GetType())
+		return false, "", err
+	}
+	names, err := getNames()
+	if err != nil {
+		return false, "", err
+	}
+	owned := map[string]bool{}
+	for _, name := range names {
+		owned[name] = true
+	}
+	changed := false
+	prefix := handler.GetObjectPrefix()
+	for _, name := range runtime_names {
+		// the objects without the prefix are not owned by the operator, so never touch them
+		if !strings.HasPrefix(name, prefix) || owned[name] {
+			continue
+		}
+		reqLogger.Info("Deleting orphan object", "name", name)
+		err = handler.DeleteObject(ctx, clientInfo, name)
+		if openwrt.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			reqLogger.Error(err, "Failed to delete orphan object", "name", name)
+			return changed, "", err
 		}
+		changed = true
 	}
-	// We say the deletioni succeed only when the deletion for all pods succeed
-	return cnfChanged, nil
+	if !changed {
+		return false, "", nil
+	}
+	action, err := p.scheduleService(ctx, handler, clientInfo, p.onServiceAction)
+	if err != nil {
+		reqLogger.Error(err, "Failed to schedule openwrt service action")
+	}
+	return true, action, err
+}
+
+// deleteLegacyObject deletes the object named after the CR without the prefix, which was created
+// before the prefix was introduced. It's done once, when the object with the prefix is created, and
+// only for the kinds of basehandler.ILegacyHandler. An object which differs from the one the operator
+// would have written, e.g. a built-in one with the name of the CR, is kept and has to be migrated by hand.
+// A failure is only logged, the legacy object is kept then.
+func deleteLegacyObject(ctx context.Context, handler basehandler.ISdewanHandler, new_instance openwrt.IOpenWrtObject, clientInfo *openwrt.OpenwrtClientInfo, reqLogger logr.Logger) {
+	legacyHandler, ok := handler.(basehandler.ILegacyHandler)
+	if !ok {
+		return
+	}
+	legacy := strings.TrimPrefix(new_instance.GetName(), handler.GetObjectPrefix())
+	if legacy == new_instance.GetName() {
+		return
+	}
+	legacy_instance, err := getRuntimeObject(ctx, handler, clientInfo, legacy)
+	if err != nil {
+		reqLogger.Error(err, "Failed to get legacy object", "name", legacy)
+		return
+	}
+	if legacy_instance == nil {
+		return
+	}
+	if !legacyHandler.IsLegacyObject(legacy_instance, new_instance) {
+		reqLogger.Info("Keeping the object named after the CR, which is not the one written by the operator", "name", legacy)
+		return
+	}
+	err = handler.DeleteObject(ctx, clientInfo, legacy)
+	if err == nil {
+		reqLogger.Info("Deleted legacy object", "name", legacy)
+	} else if !openwrt.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to delete legacy object", "name", legacy)
+	}
+}
+
+// getRuntimeObject gets the object of a pod, which is nil if the object doesn't exist. Any other
+// error is returned, so that an unreachable pod is never taken as a pod without the object.
+func getRuntimeObject(ctx context.Context, handler basehandler.ISdewanHandler, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	runtime_instance, err := handler.GetObject(ctx, clientInfo, name)
+	if openwrt.IsNotFound(err) {
+		return nil, nil
+	}
+	return runtime_instance, err
+}
+
+// PodKey identifies a pod together with the restarts of its containers. A restarted
+// container may come up without the runtime config, so the key of a pod which has
+// to get the CRs again differs from the one the CRs were applied to.
+func PodKey(pod *corev1.Pod) string {
+	var restarts int32
+	for _, status := range pod.Status.ContainerStatuses {
+		restarts += status.RestartCount
+	}
+	return fmt.Sprintf("%s/%d", pod.UID, restarts)
+}
+
+// readyPods returns the ready pods sorted by name. The pods which are not ready are
+// skipped, as they get the config once they turn ready.
+func readyPods(pods []corev1.Pod) []*corev1.Pod {
+	var ready []*corev1.Pod
+	for i := range pods {
+		if IsPodReady(&pods[i]) {
+			ready = append(ready, &pods[i])
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].Name < ready[j].Name })
+	return ready
+}
+
+// forEachPod calls fn for the pods in parallel, with at most PodWorkers pods at the
+// same time, and returns the results in the order of the pods
+func (p *OpenWrtProvider) forEachPod(ctx context.Context, pods []*corev1.Pod, timeout time.Duration, fn func(ctx context.Context, pod *corev1.Pod) PodResult) []PodResult {
+	workers := PodWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]PodResult, len(pods))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, pod := range pods {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pod *corev1.Pod) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = callWithTimeout(ctx, pod, timeout, fn)
+			results[i].Key = PodKey(pod)
+		}(i, pod)
+	}
+	wg.Wait()
+	return results
+}
+
+// callWithTimeout calls fn for a pod with a context cancelled after the timeout, so the requests
+// to a hung pod are interrupted and fn returns with the error of the interrupted request.
+func callWithTimeout(ctx context.Context, pod *corev1.Pod, timeout time.Duration, fn func(ctx context.Context, pod *corev1.Pod) PodResult) PodResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result := fn(ctx, pod)
+	if result.Err != nil && ctx.Err() == context.DeadlineExceeded {
+		result.Err = fmt.Errorf("Timeout after %v: %w", timeout, result.Err)
+	}
+	return result
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func resultsChanged(results []PodResult) bool {
+	for _, result := range results {
+		if result.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+// resultsError aggregates the errors of the pods into one error
+func resultsError(results []PodResult) error {
+	var msgs []string
+	for _, result := range results {
+		if result.Err != nil {
+			msgs = append(msgs, result.Name+": "+result.Err.Error())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New("Failed on pods: " + strings.Join(msgs, "; "))
 }
@@ -0,0 +1,365 @@
+package cnfprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sdewan.akraino.org/sdewan/basehandler"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+func newPods(n int) []*corev1.Pod {
+	pods := make([]*corev1.Pod, n)
+	for i := range pods {
+		pods[i] = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("cnf-%d", i), UID: types.UID(fmt.Sprintf("uid-%d", i))},
+			Status:     corev1.PodStatus{PodIP: fmt.Sprintf("10.0.0.%d", i+1)},
+		}
+	}
+	return pods
+}
+
+func setPodWorkers(t *testing.T, workers int) {
+	old := PodWorkers
+	PodWorkers = workers
+	t.Cleanup(func() {
+		PodWorkers = old
+	})
+}
+
+func TestForEachPodLimitsWorkers(t *testing.T) {
+	setPodWorkers(t, 2)
+	var running, maxRunning int32
+	p := &OpenWrtProvider{}
+	results := p.forEachPod(context.Background(), newPods(6), time.Second, func(ctx context.Context, pod *corev1.Pod) PodResult {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return PodResult{Name: pod.Name}
+	})
+	if maxRunning != 2 {
+		t.Errorf("got %d pods at the same time, want 2", maxRunning)
+	}
+	for i, result := range results {
+		if want := fmt.Sprintf("cnf-%d", i); result.Name != want {
+			t.Errorf("got result %d of pod %s, want %s", i, result.Name, want)
+		}
+		if want := fmt.Sprintf("uid-%d/0", i); result.Key != want {
+			t.Errorf("got key %s of pod %s, want %s", result.Key, result.Name, want)
+		}
+	}
+}
+
+func TestForEachPodTimeout(t *testing.T) {
+	p := &OpenWrtProvider{}
+	start := time.Now()
+	results := p.forEachPod(context.Background(), newPods(2), 50*time.Millisecond, func(ctx context.Context, pod *corev1.Pod) PodResult {
+		if pod.Name == "cnf-0" {
+			// a hung pod, whose request is interrupted by the timeout
+			<-ctx.Done()
+			return PodResult{Name: pod.Name, Err: ctx.Err()}
+		}
+		return PodResult{Name: pod.Name}
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the hung pod took %v", elapsed)
+	}
+	if !errors.Is(results[0].Err, context.DeadlineExceeded) {
+		t.Errorf("got error %v of the hung pod, want a timeout", results[0].Err)
+	}
+	if results[1].Err != nil {
+		t.Errorf("got error %v of the other pod", results[1].Err)
+	}
+}
+
+func TestRolloutStopsOnFailure(t *testing.T) {
+	setPodWorkers(t, 4)
+	tests := []struct {
+		name    string
+		rollout RolloutStrategy
+		failing string
+		// the pods fn is called for
+		want int32
+	}{
+		{name: "all at once", rollout: RolloutStrategy{Type: RolloutAllAtOnce}, failing: "cnf-0", want: 4},
+		{name: "rolling", rollout: RolloutStrategy{Type: RolloutRolling, MaxUnavailable: 1}, failing: "cnf-1", want: 2},
+		{name: "canary", rollout: RolloutStrategy{Type: RolloutCanary}, failing: "cnf-0", want: 1},
+		{name: "canary passed", rollout: RolloutStrategy{Type: RolloutCanary}, failing: "cnf-2", want: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var called int32
+			p := &OpenWrtProvider{Rollout: test.rollout}
+			results := p.rollout(context.Background(), newPods(4), func(ctx context.Context, pod *corev1.Pod) PodResult {
+				atomic.AddInt32(&called, 1)
+				if pod.Name == test.failing {
+					return PodResult{Name: pod.Name, Err: fmt.Errorf("check failed")}
+				}
+				return PodResult{Name: pod.Name}
+			})
+			if called != test.want {
+				t.Errorf("got %d pods changed, want %d", called, test.want)
+			}
+			if len(results) != 4 {
+				t.Fatalf("got %d results, want 4", len(results))
+			}
+			if resultsError(results) == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+type fakeObject struct {
+	Name  string
+	Value string
+}
+
+func (o *fakeObject) GetName() string {
+	return o.Name
+}
+
+// fakeObjectHandler keeps the runtime objects of a pod in memory, and records the changes to them
+type fakeObjectHandler struct {
+	*fakeServiceHandler
+	// returned by GetObject instead of the object
+	getErr error
+	// returned by CheckHealth
+	healthErr error
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	changes []string
+}
+
+func newFakeObjectHandler(objects ...fakeObject) *fakeObjectHandler {
+	h := &fakeObjectHandler{fakeServiceHandler: &fakeServiceHandler{actions: reloadOnly}, objects: map[string]fakeObject{}}
+	for _, o := range objects {
+		h.objects[o.Name] = o
+	}
+	return h
+}
+
+func (h *fakeObjectHandler) GetType() string {
+	return "Fake"
+}
+
+func (h *fakeObjectHandler) GetObjectPrefix() string {
+	return "sdwfk_"
+}
+
+func (h *fakeObjectHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	return *instance1.(*fakeObject) == *instance2.(*fakeObject)
+}
+
+func (h *fakeObjectHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.getErr != nil {
+		return nil, h.getErr
+	}
+	o, ok := h.objects[name]
+	if !ok {
+		return nil, &openwrt.NotFoundError{OpenwrtError: &openwrt.OpenwrtError{Code: 404, Message: "not found"}}
+	}
+	return &o, nil
+}
+
+func (h *fakeObjectHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	return h.put("create", instance)
+}
+
+func (h *fakeObjectHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	return h.put("update", instance)
+}
+
+func (h *fakeObjectHandler) put(change string, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	o := *instance.(*fakeObject)
+	h.objects[o.Name] = o
+	h.changes = append(h.changes, change+" "+o.Name+"="+o.Value)
+	return &o, nil
+}
+
+func (h *fakeObjectHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.objects[name]; !ok {
+		return &openwrt.NotFoundError{OpenwrtError: &openwrt.OpenwrtError{Code: 404, Message: "not found"}}
+	}
+	delete(h.objects, name)
+	h.changes = append(h.changes, "delete "+name)
+	return nil
+}
+
+func (h *fakeObjectHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var names []string
+	for name := range h.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (h *fakeObjectHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return h.healthErr
+}
+
+func (h *fakeObjectHandler) getChanges() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.changes...)
+}
+
+func TestAddOrUpdatePodCreatesOnlyOnNotFound(t *testing.T) {
+	setBatchWindow(t, 10*time.Millisecond, time.Second)
+	tests := []struct {
+		name        string
+		getErr      error
+		wantErr     func(error) bool
+		wantChanges []string
+	}{
+		{name: "not found", wantChanges: []string{"create sdwfk_a=1"}},
+		{name: "server error", getErr: &openwrt.ServerError{OpenwrtError: &openwrt.OpenwrtError{Code: 503}}, wantErr: openwrt.IsServerError},
+		{name: "transport error", getErr: &openwrt.TransportError{Err: context.DeadlineExceeded}, wantErr: openwrt.IsTransport},
+		{name: "unauthorized", getErr: &openwrt.UnauthorizedError{OpenwrtError: &openwrt.OpenwrtError{Code: 401}}, wantErr: openwrt.IsUnauthorized},
+		{name: "invalid response", getErr: errors.New("invalid character"), wantErr: func(err error) bool { return err != nil }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newFakeObjectHandler()
+			handler.getErr = test.getErr
+			p := &OpenWrtProvider{GetCapabilities: staticCapabilities}
+			clientInfo := &openwrt.OpenwrtClientInfo{Ip: "10.0.1.1"}
+			_, _, _, err := p.addOrUpdatePod(context.Background(), handler, &fakeObject{Name: "sdwfk_a", Value: "1"}, nil, clientInfo, log)
+			if test.wantErr == nil && err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if test.wantErr != nil && !test.wantErr(err) {
+				t.Errorf("got error %v", err)
+			}
+			if got := handler.getChanges(); !sameStrings(got, test.wantChanges) {
+				t.Errorf("got changes %v, want %v", got, test.wantChanges)
+			}
+		})
+	}
+}
+
+func TestScheduledActionFailureRestoresSnapshot(t *testing.T) {
+	setBatchWindow(t, 50*time.Millisecond, time.Second)
+	tests := []struct {
+		name string
+		// the object set on the pod by another change before the action
+		changedSince *fakeObject
+		wantChanges  []string
+		wantObject   fakeObject
+	}{
+		{name: "restored", wantChanges: []string{"update sdwfk_a=1", "update sdwfk_a=0"}, wantObject: fakeObject{"sdwfk_a", "0"}},
+		{name: "changed since", changedSince: &fakeObject{"sdwfk_a", "2"}, wantChanges: []string{"update sdwfk_a=1", "update sdwfk_a=2"}, wantObject: fakeObject{"sdwfk_a", "2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newFakeObjectHandler(fakeObject{"sdwfk_a", "0"})
+			handler.err = errors.New("reload failed")
+			handler.failures = 1
+			done := make(chan error, 1)
+			p := &OpenWrtProvider{GetCapabilities: staticCapabilities, Rollout: RolloutStrategy{Type: RolloutAllAtOnce}, OnServiceAction: func(err error) {
+				done <- err
+			}}
+			clientInfo := &openwrt.OpenwrtClientInfo{Ip: "10.0.1.1"}
+			changed, _, _, err := p.addOrUpdatePod(context.Background(), handler, &fakeObject{"sdwfk_a", "1"}, nil, clientInfo, log)
+			if err != nil || !changed {
+				t.Fatalf("got changed %v, error %v", changed, err)
+			}
+			if test.changedSince != nil {
+				handler.put("update", test.changedSince)
+			}
+			select {
+			case err = <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("the result of the service action is not reported")
+			}
+			if err == nil {
+				t.Error("got no error of the failed service action")
+			}
+			if got := handler.getChanges(); !reflect.DeepEqual(got, test.wantChanges) {
+				t.Errorf("got changes %v, want %v", got, test.wantChanges)
+			}
+			if object, _ := handler.GetObject(context.Background(), clientInfo, "sdwfk_a"); *object.(*fakeObject) != test.wantObject {
+				t.Errorf("got object %v, want %v", object, test.wantObject)
+			}
+		})
+	}
+}
+
+func TestDeleteOrphanPodKeepsUnprefixedObjects(t *testing.T) {
+	setBatchWindow(t, 10*time.Millisecond, time.Second)
+	// lan and a are named after CRs without the prefix, e.g. built-in objects, or the ones written
+	// before the prefix was introduced
+	handler := newFakeObjectHandler(fakeObject{"sdwfk_a", "1"}, fakeObject{"sdwfk_b", "1"}, fakeObject{"a", "1"}, fakeObject{"lan", "1"})
+	p := &OpenWrtProvider{GetCapabilities: staticCapabilities}
+	getNames := func() ([]string, error) {
+		return []string{"sdwfk_a", "sdwfk_lan"}, nil
+	}
+	changed, _, err := p.deleteOrphanPod(context.Background(), handler, getNames, &openwrt.OpenwrtClientInfo{Ip: "10.0.1.1"}, log)
+	if err != nil || !changed {
+		t.Fatalf("got changed %v, error %v", changed, err)
+	}
+	if got, want := handler.getChanges(), []string{"delete sdwfk_b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got changes %v, want %v", got, want)
+	}
+}
+
+// fakeLegacyHandler takes a legacy object with the same value as the one the operator wrote
+type fakeLegacyHandler struct {
+	*fakeObjectHandler
+}
+
+func (h *fakeLegacyHandler) IsLegacyObject(legacy openwrt.IOpenWrtObject, instance openwrt.IOpenWrtObject) bool {
+	return legacy.(*fakeObject).Value == instance.(*fakeObject).Value
+}
+
+func TestDeleteLegacyObject(t *testing.T) {
+	tests := []struct {
+		name        string
+		legacy      bool
+		object      fakeObject
+		wantChanges []string
+	}{
+		{name: "legacy object", legacy: true, object: fakeObject{"lan", "1"}, wantChanges: []string{"delete lan"}},
+		{name: "other object", legacy: true, object: fakeObject{"lan", "builtin"}},
+		{name: "kind without legacy objects", object: fakeObject{"lan", "1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects := newFakeObjectHandler(test.object)
+			var handler basehandler.ISdewanHandler = objects
+			if test.legacy {
+				handler = &fakeLegacyHandler{objects}
+			}
+			deleteLegacyObject(context.Background(), handler, &fakeObject{"sdwfk_lan", "1"}, &openwrt.OpenwrtClientInfo{Ip: "10.0.1.1"}, log)
+			if got := objects.getChanges(); !sameStrings(got, test.wantChanges) {
+				t.Errorf("got changes %v, want %v", got, test.wantChanges)
+			}
+		})
+	}
+}
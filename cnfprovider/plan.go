@@ -0,0 +1,139 @@
+package cnfprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/basehandler"
+	"sdewan.akraino.org/sdewan/openwrt"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PlanObject computes the changes AddOrUpdateObject, or DeleteObject if isDelete, would make
+// to the ready pods, without any change to the cnf
+func (p *OpenWrtProvider) PlanObject(ctx context.Context, handler basehandler.ISdewanHandler, instance runtime.Object, isDelete bool) ([]batchv1alpha1.SdewanPodPlan, error) {
+	reqLogger := log.WithValues(handler.GetType(), handler.GetName(instance), "cnf", p.Deployment.Name)
+	podList := &corev1.PodList{}
+	err := p.K8sClient.List(ctx, podList, client.InNamespace(p.Namespace), client.MatchingLabels{"sdewanPurpose": p.SdewanPurpose})
+	if err != nil {
+		reqLogger.Error(err, "Failed to get cnf pod list")
+		return nil, err
+	}
+	var new_instance openwrt.IOpenWrtObject
+	if !isDelete {
+		new_instance, err = handler.Convert(p.K8sClient, instance, p.Deployment)
+		if err != nil {
+			reqLogger.Error(err, "Failed to convert CR for "+handler.GetType())
+			return nil, err
+		}
+	}
+	pods := readyPods(podList.Items)
+	plans := make([]batchv1alpha1.SdewanPodPlan, len(pods))
+	index := map[string]int{}
+	for i, pod := range pods {
+		index[pod.Name] = i
+	}
+	results := p.forEachPod(ctx, pods, PodTimeout, func(ctx context.Context, pod *corev1.Pod) PodResult {
+		clientInfo := p.getClientInfo(pod)
+		runtime_instance, err := getRuntimeObject(ctx, handler, clientInfo, handler.GetName(instance))
+		if err != nil {
+			return PodResult{Name: pod.Name, Ip: pod.Status.PodIP, Err: err}
+		}
+		plan := batchv1alpha1.SdewanPodPlan{Pod: pod.Name, Action: batchv1alpha1.PlanActionNone}
+		switch {
+		case isDelete && runtime_instance != nil:
+			plan.Action = batchv1alpha1.PlanActionDelete
+		case isDelete:
+		case runtime_instance == nil:
+			plan.Action = batchv1alpha1.PlanActionCreate
+			plan.Diff = diffObjects(nil, new_instance)
+		case !handler.IsEqual(runtime_instance, new_instance):
+			plan.Action = batchv1alpha1.PlanActionUpdate
+			plan.Diff = diffObjects(runtime_instance, new_instance)
+		}
+		plans[index[pod.Name]] = plan
+		return PodResult{Name: pod.Name, Ip: pod.Status.PodIP}
+	})
+	return plans, resultsError(results)
+}
+
+// diffObjects returns the changed fields from old to new in the form "field: old -> new"
+func diffObjects(old openwrt.IOpenWrtObject, new openwrt.IOpenWrtObject) []string {
+	oldFields := objectFields(old)
+	newFields := objectFields(new)
+	masked := maskedFields(old)
+	for name := range maskedFields(new) {
+		masked[name] = true
+	}
+	var names []string
+	for name := range newFields {
+		names = append(names, name)
+	}
+	for name := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var diff []string
+	for _, name := range names {
+		oldValue, newValue := oldFields[name], newFields[name]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if masked[name] {
+			diff = append(diff, name+": changed")
+			continue
+		}
+		diff = append(diff, fmt.Sprintf("%s: %s -> %s", name, fieldString(oldValue), fieldString(newValue)))
+	}
+	return diff
+}
+
+func objectFields(o openwrt.IOpenWrtObject) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if o == nil || reflect.ValueOf(o).IsNil() {
+		return fields
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+// maskedFields returns the json names of the fields tagged diff:"masked", whose values are never
+// shown in a diff: the key material, and the certificates which are too long for it
+func maskedFields(o openwrt.IOpenWrtObject) map[string]bool {
+	masked := map[string]bool{}
+	if o == nil || reflect.ValueOf(o).IsNil() {
+		return masked
+	}
+	t := reflect.Indirect(reflect.ValueOf(o)).Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("diff") == "masked" {
+			masked[strings.Split(field.Tag.Get("json"), ",")[0]] = true
+		}
+	}
+	return masked
+}
+
+func fieldString(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
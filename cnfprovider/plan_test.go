@@ -0,0 +1,77 @@
+package cnfprovider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDiffObjects(t *testing.T) {
+	site := openwrt.SdewanIpsecSite{Name: "site", Gateway: "10.0.0.1", PreSharedKey: "old-psk", LocalPrivateCert: "old-key"}
+	changed := site
+	changed.Gateway = "10.0.0.2"
+	changed.PreSharedKey = "new-psk"
+	changed.LocalPrivateCert = "new-key"
+	tests := []struct {
+		name string
+		old  openwrt.IOpenWrtObject
+		new  openwrt.IOpenWrtObject
+		want []string
+	}{
+		{name: "equal", old: &fakeObject{"a", "1"}, new: &fakeObject{"a", "1"}},
+		{name: "changed field", old: &fakeObject{"a", "1"}, new: &fakeObject{"a", "2"}, want: []string{`Value: "1" -> "2"`}},
+		{name: "created", new: &fakeObject{"a", "1"}, want: []string{`Name: <none> -> "a"`, `Value: <none> -> "1"`}},
+		{name: "masked fields", old: &site, new: &changed, want: []string{`gateway: "10.0.0.1" -> "10.0.0.2"`, "local_private_cert: changed", "pre_shared_key: changed"}},
+		{name: "masked fields of a created object", new: &site, want: []string{
+			`authentication_method: <none> -> ""`, `force_crypto_proposal: <none> -> ""`,
+			`gateway: <none> -> "10.0.0.1"`, "local_private_cert: changed", "local_public_cert: changed", `local_identifier: <none> -> ""`,
+			`name: <none> -> "site"`, "pre_shared_key: changed", `remote_identifier: <none> -> ""`, "shared_ca: changed",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffObjects(test.old, test.new)
+			if !sameStrings(got, test.want) {
+				t.Errorf("got diff %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPlanObject(t *testing.T) {
+	tests := []struct {
+		name     string
+		objects  []fakeObject
+		isDelete bool
+		want     batchv1alpha1.SdewanPodPlan
+	}{
+		{name: "none", objects: []fakeObject{{"sdwfk_a", "1"}}, want: batchv1alpha1.SdewanPodPlan{Pod: "cnf-0", Action: batchv1alpha1.PlanActionNone}},
+		{name: "create", want: batchv1alpha1.SdewanPodPlan{Pod: "cnf-0", Action: batchv1alpha1.PlanActionCreate, Diff: []string{`Name: <none> -> "sdwfk_a"`, `Value: <none> -> "1"`}}},
+		{name: "update", objects: []fakeObject{{"sdwfk_a", "0"}}, want: batchv1alpha1.SdewanPodPlan{Pod: "cnf-0", Action: batchv1alpha1.PlanActionUpdate, Diff: []string{`Value: "0" -> "1"`}}},
+		{name: "delete", objects: []fakeObject{{"sdwfk_a", "1"}}, isDelete: true, want: batchv1alpha1.SdewanPodPlan{Pod: "cnf-0", Action: batchv1alpha1.PlanActionDelete}},
+		{name: "delete a missing object", isDelete: true, want: batchv1alpha1.SdewanPodPlan{Pod: "cnf-0", Action: batchv1alpha1.PlanActionNone}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &fakeCrHandler{newFakeObjectHandler(test.objects...)}
+			p := &OpenWrtProvider{Namespace: "default", SdewanPurpose: "cnf", K8sClient: fake.NewFakeClient(newReadyPods(1)...)}
+			instance := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string]string{"value": "1"}}
+			plans, err := p.PlanObject(context.Background(), handler, instance, test.isDelete)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plans) != 1 || !reflect.DeepEqual(plans[0], test.want) {
+				t.Errorf("got plans %+v, want %+v", plans, test.want)
+			}
+			if changes := handler.getChanges(); len(changes) != 0 {
+				t.Errorf("got changes %v of the cnf", changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package cnfprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sdewan.akraino.org/sdewan/basehandler"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+// LastKnownGoodAnnotation of a CR holds the json of the last spec applied to all the pods of the cnf
+const LastKnownGoodAnnotation = "sdewan.akraino.org/last-known-good"
+
+// getLastKnownGood converts the last known good spec of the CR to the openwrt object.
+// It returns nil if the CR has no last known good spec.
+func (p *OpenWrtProvider) getLastKnownGood(handler basehandler.ISdewanHandler, instance runtime.Object) (openwrt.IOpenWrtObject, error) {
+	accessor, err := meta.Accessor(instance)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := accessor.GetAnnotations()[LastKnownGoodAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	lastKnownGood := instance.DeepCopyObject()
+	field := reflect.Indirect(reflect.ValueOf(lastKnownGood)).FieldByName("Spec")
+	spec := reflect.New(field.Type())
+	err = json.Unmarshal([]byte(value), spec.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid annotation %s: %v", LastKnownGoodAnnotation, err)
+	}
+	field.Set(spec.Elem())
+	return handler.Convert(p.K8sClient, lastKnownGood, p.Deployment)
+}
+
+// restoreAfterFailure restores the object of a pod after a failed change, and returns the error of the change
+func (p *OpenWrtProvider) restoreAfterFailure(ctx context.Context, handler basehandler.ISdewanHandler, name string, snapshot openwrt.IOpenWrtObject, clientInfo *openwrt.OpenwrtClientInfo, err error, reqLogger logr.Logger) error {
+	restoreErr := p.restorePod(ctx, handler, name, snapshot, clientInfo)
+	if restoreErr != nil {
+		reqLogger.Error(restoreErr, "Failed to restore "+handler.GetType())
+		return fmt.Errorf("%w, and failed to restore: %v", err, restoreErr)
+	}
+	return fmt.Errorf("%w, and the previous config is restored", err)
+}
+
+// restoreAfterServiceFailure restores the object of a pod after the failed service action of a scheduled
+// change, and returns the error of the action. The object is kept if it was changed again since.
+func (p *OpenWrtProvider) restoreAfterServiceFailure(handler basehandler.ISdewanHandler, new_instance openwrt.IOpenWrtObject, snapshot openwrt.IOpenWrtObject, clientInfo *openwrt.OpenwrtClientInfo, err error, reqLogger logr.Logger) error {
+	// the change is over, so the restore has its own timeout
+	ctx, cancel := context.WithTimeout(context.Background(), PodTimeout)
+	defer cancel()
+	err = fmt.Errorf("Failed to execute openwrt service action: %w", err)
+	current, getErr := getRuntimeObject(ctx, handler, clientInfo, new_instance.GetName())
+	if getErr != nil {
+		reqLogger.Error(getErr, "Failed to get "+handler.GetType())
+		return fmt.Errorf("%w, and failed to restore: %v", err, getErr)
+	}
+	if current == nil || !handler.IsEqual(current, new_instance) {
+		return err
+	}
+	return p.restoreAfterFailure(ctx, handler, new_instance.GetName(), snapshot, clientInfo, err, reqLogger)
+}
+
+// restorePod sets the runtime object of a pod back to snapshot. A nil snapshot means the
+// object didn't exist, so it is deleted.
+func (p *OpenWrtProvider) restorePod(ctx context.Context, handler basehandler.ISdewanHandler, name string, snapshot openwrt.IOpenWrtObject, clientInfo *openwrt.OpenwrtClientInfo) error {
+	current, err := getRuntimeObject(ctx, handler, clientInfo, name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case snapshot == nil && current == nil:
+		return nil
+	case snapshot == nil:
+		err = handler.DeleteObject(ctx, clientInfo, name)
+	case current == nil:
+		_, err = handler.CreateObject(ctx, clientInfo, snapshot)
+	case handler.IsEqual(current, snapshot):
+		// the failed change didn't reach the runtime object, but the service may not run with it
+	default:
+		_, err = handler.UpdateObject(ctx, clientInfo, snapshot)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = p.executeService(ctx, handler, clientInfo)
+	return err
+}
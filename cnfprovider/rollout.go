@@ -0,0 +1,142 @@
+package cnfprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"sdewan.akraino.org/sdewan/basehandler"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+// Rollout strategy types
+const (
+	// apply to all the pods at the same time, without health check
+	RolloutAllAtOnce = "AllAtOnce"
+	// apply to MaxUnavailable pods at a time, and continue only if they pass the health check
+	RolloutRolling = "Rolling"
+	// apply to one pod first, and continue with the others only if it passes the health check
+	RolloutCanary = "Canary"
+)
+
+// The annotation of the cnf deployment to set the rollout strategy of the CRs for the cnf,
+// e.g. {"type": "Canary", "checkDelaySeconds": 10}
+const rolloutAnnotation = "sdewan.akraino.org/rollout"
+
+// RolloutStrategy is how a CR is applied to the pods of a cnf
+type RolloutStrategy struct {
+	Type string `json:"type"`
+	// the number of pods changed at a time by Rolling, 1 by default
+	MaxUnavailable int `json:"maxUnavailable,omitempty"`
+	// how long to wait after a change before the health check
+	CheckDelaySeconds int `json:"checkDelaySeconds,omitempty"`
+}
+
+func getRolloutStrategy(deployment extensionsv1beta1.Deployment) (RolloutStrategy, error) {
+	strategy := RolloutStrategy{Type: RolloutAllAtOnce}
+	value, ok := deployment.Annotations[rolloutAnnotation]
+	if !ok {
+		return strategy, nil
+	}
+	err := json.Unmarshal([]byte(value), &strategy)
+	if err != nil {
+		return strategy, fmt.Errorf("Invalid annotation %s: %v", rolloutAnnotation, err)
+	}
+	switch strategy.Type {
+	case RolloutAllAtOnce, RolloutCanary:
+	case RolloutRolling:
+		if strategy.MaxUnavailable < 1 {
+			strategy.MaxUnavailable = 1
+		}
+	default:
+		return strategy, fmt.Errorf("Invalid annotation %s: unknown type %s", rolloutAnnotation, strategy.Type)
+	}
+	return strategy, nil
+}
+
+// ErrRolloutStopped is the error of the pods which are not changed, as the rollout stopped at a failed pod
+var ErrRolloutStopped = errors.New("rollout stopped by the failed pods")
+
+// rollout calls fn for the pods in batches by the rollout strategy. When a batch fails,
+// the remaining pods are not changed and fail with a rollout error.
+func (p *OpenWrtProvider) rollout(ctx context.Context, pods []*corev1.Pod, fn func(ctx context.Context, pod *corev1.Pod) PodResult) []PodResult {
+	var batches [][]*corev1.Pod
+	switch p.Rollout.Type {
+	case RolloutRolling:
+		for i := 0; i < len(pods); i += p.Rollout.MaxUnavailable {
+			end := i + p.Rollout.MaxUnavailable
+			if end > len(pods) {
+				end = len(pods)
+			}
+			batches = append(batches, pods[i:end])
+		}
+	case RolloutCanary:
+		if len(pods) > 0 {
+			batches = append(batches, pods[:1])
+		}
+		if len(pods) > 1 {
+			batches = append(batches, pods[1:])
+		}
+	default:
+		batches = append(batches, pods)
+	}
+	timeout := PodTimeout + time.Duration(p.Rollout.CheckDelaySeconds)*time.Second
+	var results []PodResult
+	for i, batch := range batches {
+		batchResults := p.forEachPod(ctx, batch, timeout, fn)
+		results = append(results, batchResults...)
+		if resultsError(batchResults) == nil {
+			continue
+		}
+		for _, rest := range batches[i+1:] {
+			for _, pod := range rest {
+				results = append(results, PodResult{Name: pod.Name, Ip: pod.Status.PodIP, Key: PodKey(pod), Err: fmt.Errorf("%s %w", p.Rollout.Type, ErrRolloutStopped)})
+			}
+		}
+		break
+	}
+	return results
+}
+
+// checkPod checks the pod after a change, and reverts the change if the check fails.
+// It returns whether the change is reverted.
+func (p *OpenWrtProvider) checkPod(ctx context.Context, handler basehandler.ISdewanHandler, new_instance openwrt.IOpenWrtObject, previous openwrt.IOpenWrtObject, clientInfo *openwrt.OpenwrtClientInfo, reqLogger logr.Logger) (bool, error) {
+	select {
+	case <-time.After(time.Duration(p.Rollout.CheckDelaySeconds) * time.Second):
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	err := checkHealth(ctx, handler, new_instance, clientInfo)
+	if err == nil {
+		return false, nil
+	}
+	if previous != nil && handler.IsEqual(previous, new_instance) {
+		// e.g. the object of a restarted pod, whose last known good spec is the current one
+		reqLogger.Error(err, "Health check failed, and the last known good config is the applied one")
+		return false, fmt.Errorf("Health check failed: %w, and the last known good config is the applied one, so it's kept", err)
+	}
+	reqLogger.Error(err, "Health check failed, reverting the change")
+	revertErr := p.restorePod(ctx, handler, new_instance.GetName(), previous, clientInfo)
+	if revertErr != nil {
+		reqLogger.Error(revertErr, "Failed to revert the change")
+		return false, fmt.Errorf("Health check failed: %w, and failed to revert: %v", err, revertErr)
+	}
+	return true, fmt.Errorf("Health check failed and the change is reverted: %w", err)
+}
+
+// checkHealth checks that the runtime object is the applied one, and the service is healthy with it
+func checkHealth(ctx context.Context, handler basehandler.ISdewanHandler, new_instance openwrt.IOpenWrtObject, clientInfo *openwrt.OpenwrtClientInfo) error {
+	runtime_instance, err := getRuntimeObject(ctx, handler, clientInfo, new_instance.GetName())
+	if err != nil {
+		return err
+	}
+	if runtime_instance == nil || !handler.IsEqual(runtime_instance, new_instance) {
+		return fmt.Errorf("%s %s differs from the applied one", handler.GetType(), new_instance.GetName())
+	}
+	return handler.CheckHealth(ctx, clientInfo, new_instance)
+}
@@ -0,0 +1,171 @@
+package cnfprovider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sdewan.akraino.org/sdewan/openwrt"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCheckPod(t *testing.T) {
+	setBatchWindow(t, 10*time.Millisecond, time.Second)
+	tests := []struct {
+		name      string
+		healthErr error
+		previous  *fakeObject
+		// the object of the pod after the check
+		wantObject   *fakeObject
+		wantReverted bool
+		wantErr      bool
+		wantChanges  []string
+	}{
+		{name: "healthy", previous: &fakeObject{"sdwfk_a", "0"}, wantObject: &fakeObject{"sdwfk_a", "1"}},
+		{name: "reverted to the previous object", healthErr: errors.New("down"), previous: &fakeObject{"sdwfk_a", "0"},
+			wantObject: &fakeObject{"sdwfk_a", "0"}, wantReverted: true, wantErr: true, wantChanges: []string{"update sdwfk_a=0"}},
+		{name: "reverted to no object", healthErr: errors.New("down"),
+			wantReverted: true, wantErr: true, wantChanges: []string{"delete sdwfk_a"}},
+		{name: "the previous object is the applied one", healthErr: errors.New("down"), previous: &fakeObject{"sdwfk_a", "1"},
+			wantObject: &fakeObject{"sdwfk_a", "1"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newFakeObjectHandler(fakeObject{"sdwfk_a", "1"})
+			handler.healthErr = test.healthErr
+			p := &OpenWrtProvider{GetCapabilities: staticCapabilities, Rollout: RolloutStrategy{Type: RolloutCanary}}
+			clientInfo := &openwrt.OpenwrtClientInfo{Ip: "10.0.1.1"}
+			var previous openwrt.IOpenWrtObject
+			if test.previous != nil {
+				previous = test.previous
+			}
+			reverted, err := p.checkPod(context.Background(), handler, &fakeObject{"sdwfk_a", "1"}, previous, clientInfo, log)
+			if reverted != test.wantReverted {
+				t.Errorf("got reverted %v, want %v", reverted, test.wantReverted)
+			}
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			if got := handler.getChanges(); !sameStrings(got, test.wantChanges) {
+				t.Errorf("got changes %v, want %v", got, test.wantChanges)
+			}
+			object, _ := handler.GetObject(context.Background(), clientInfo, "sdwfk_a")
+			if test.wantObject == nil && object != nil || test.wantObject != nil && !reflect.DeepEqual(object, test.wantObject) {
+				t.Errorf("got object %v, want %v", object, test.wantObject)
+			}
+		})
+	}
+}
+
+func TestRestorePod(t *testing.T) {
+	setBatchWindow(t, 10*time.Millisecond, time.Second)
+	tests := []struct {
+		name     string
+		current  *fakeObject
+		snapshot *fakeObject
+		// the changes to the object, and whether the service runs with the restored object
+		wantChanges []string
+		wantAction  bool
+	}{
+		{name: "nothing to restore"},
+		{name: "created object is deleted", current: &fakeObject{"sdwfk_a", "1"}, wantChanges: []string{"delete sdwfk_a"}, wantAction: true},
+		{name: "deleted object is created", snapshot: &fakeObject{"sdwfk_a", "0"}, wantChanges: []string{"create sdwfk_a=0"}, wantAction: true},
+		{name: "updated object is restored", current: &fakeObject{"sdwfk_a", "1"}, snapshot: &fakeObject{"sdwfk_a", "0"}, wantChanges: []string{"update sdwfk_a=0"}, wantAction: true},
+		{name: "unchanged object", current: &fakeObject{"sdwfk_a", "0"}, snapshot: &fakeObject{"sdwfk_a", "0"}, wantAction: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newFakeObjectHandler()
+			if test.current != nil {
+				handler = newFakeObjectHandler(*test.current)
+			}
+			var snapshot openwrt.IOpenWrtObject
+			if test.snapshot != nil {
+				snapshot = test.snapshot
+			}
+			p := &OpenWrtProvider{GetCapabilities: staticCapabilities}
+			clientInfo := &openwrt.OpenwrtClientInfo{Ip: "10.0.1.1"}
+			if err := p.restorePod(context.Background(), handler, "sdwfk_a", snapshot, clientInfo); err != nil {
+				t.Fatal(err)
+			}
+			if got := handler.getChanges(); !sameStrings(got, test.wantChanges) {
+				t.Errorf("got changes %v, want %v", got, test.wantChanges)
+			}
+			if action := len(handler.getExecuted()) > 0; action != test.wantAction {
+				t.Errorf("got service action %v, want %v", action, test.wantAction)
+			}
+		})
+	}
+}
+
+// fakeCrHandler converts a ConfigMap to the fake object, named after the ConfigMap
+type fakeCrHandler struct {
+	*fakeObjectHandler
+}
+
+func (h *fakeCrHandler) GetName(instance runtime.Object) string {
+	return h.GetObjectPrefix() + instance.(*corev1.ConfigMap).Name
+}
+
+func (h *fakeCrHandler) Convert(r client.Client, o runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	return &fakeObject{Name: h.GetName(o), Value: o.(*corev1.ConfigMap).Data["value"]}, nil
+}
+
+func newReadyPods(n int) []runtime.Object {
+	var objects []runtime.Object
+	for _, pod := range newPods(n) {
+		pod.Namespace = "default"
+		pod.Labels = map[string]string{"sdewanPurpose": "cnf"}
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		objects = append(objects, pod)
+	}
+	return objects
+}
+
+func TestCanaryHoldsRevertedChange(t *testing.T) {
+	setBatchWindow(t, 10*time.Millisecond, time.Second)
+	tests := []struct {
+		name         string
+		revertedPods []string
+		wantChanges  []string
+	}{
+		{name: "reverted", wantChanges: []string{"update sdwfk_a=1", "update sdwfk_a=0"}},
+		{name: "held", revertedPods: []string{"cnf-0"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &fakeCrHandler{newFakeObjectHandler(fakeObject{"sdwfk_a", "0"})}
+			handler.healthErr = errors.New("down")
+			p := &OpenWrtProvider{
+				Namespace:       "default",
+				SdewanPurpose:   "cnf",
+				K8sClient:       fake.NewFakeClient(newReadyPods(3)...),
+				GetCapabilities: staticCapabilities,
+				Rollout:         RolloutStrategy{Type: RolloutCanary},
+			}
+			instance := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string]string{"value": "1"}}
+			_, results, err := p.AddOrUpdateObject(context.Background(), handler, instance, nil, test.revertedPods)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if !results[0].Reverted {
+				t.Errorf("got result %+v of the canary, want it reverted", results[0])
+			}
+			for _, result := range results[1:] {
+				if !errors.Is(result.Err, ErrRolloutStopped) {
+					t.Errorf("got error %v of pod %s, want the rollout stopped", result.Err, result.Name)
+				}
+			}
+			if got := handler.getChanges(); !sameStrings(got, test.wantChanges) {
+				t.Errorf("got changes %v, want %v", got, test.wantChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package cnfprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sdewan.akraino.org/sdewan/openwrt"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The annotation of the cnf deployment to access the cnf with https, e.g.
+// {"scheme": "https", "port": 8443, "caSecret": "cnf-ca", "clientCertSecret": "cnf-client"}
+const transportAnnotation = "sdewan.akraino.org/transport"
+
+// TransportConfig is the value of the transport annotation
+type TransportConfig struct {
+	// http (default) or https
+	Scheme string `json:"scheme,omitempty"`
+	// the port of the LuCI server, the default port of the scheme if 0
+	Port int `json:"port,omitempty"`
+	// the Secret or ConfigMap with the PEM CA bundle in the caKey key (ca.crt by default)
+	CASecret    string `json:"caSecret,omitempty"`
+	CAConfigMap string `json:"caConfigMap,omitempty"`
+	CAKey       string `json:"caKey,omitempty"`
+	// the kubernetes.io/tls Secret with the client certificate
+	ClientCertSecret string `json:"clientCertSecret,omitempty"`
+	// the name in the server certificate, as the certificate rarely has the pod IP
+	ServerName string `json:"serverName,omitempty"`
+	// skip the verification of the server certificate, for lab use only
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+const defaultCAKey = "ca.crt"
+
+// getTransport reads the scheme, port and TLS setting of the cnf. Like the credentials,
+// the Secrets and ConfigMap are read for every provider, so the renewed certificates are used.
+func getTransport(k8sClient client.Client, deployment extensionsv1beta1.Deployment) (string, int, *openwrt.TLSConfig, error) {
+	value, ok := deployment.Annotations[transportAnnotation]
+	if !ok {
+		return openwrt.SchemeHTTP, 0, nil, nil
+	}
+	config := TransportConfig{}
+	err := json.Unmarshal([]byte(value), &config)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("Invalid annotation %s: %v", transportAnnotation, err)
+	}
+	switch config.Scheme {
+	case "", openwrt.SchemeHTTP:
+		return openwrt.SchemeHTTP, config.Port, nil, nil
+	case openwrt.SchemeHTTPS:
+	default:
+		return "", 0, nil, fmt.Errorf("Invalid annotation %s: unsupported scheme %s", transportAnnotation, config.Scheme)
+	}
+
+	ctx := context.Background()
+	tlsConfig := &openwrt.TLSConfig{ServerName: config.ServerName, InsecureSkipVerify: config.InsecureSkipVerify}
+	caKey := config.CAKey
+	if caKey == "" {
+		caKey = defaultCAKey
+	}
+	if config.CASecret != "" {
+		secret := &corev1.Secret{}
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: deployment.Namespace, Name: config.CASecret}, secret)
+		if err != nil {
+			return "", 0, nil, fmt.Errorf("Failed to get CA secret %s: %v", config.CASecret, err)
+		}
+		if tlsConfig.CA, ok = secret.Data[caKey]; !ok {
+			return "", 0, nil, fmt.Errorf("No key %s in CA secret %s", caKey, config.CASecret)
+		}
+	} else if config.CAConfigMap != "" {
+		configMap := &corev1.ConfigMap{}
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: deployment.Namespace, Name: config.CAConfigMap}, configMap)
+		if err != nil {
+			return "", 0, nil, fmt.Errorf("Failed to get CA configmap %s: %v", config.CAConfigMap, err)
+		}
+		ca, ok := configMap.Data[caKey]
+		if !ok {
+			return "", 0, nil, fmt.Errorf("No key %s in CA configmap %s", caKey, config.CAConfigMap)
+		}
+		tlsConfig.CA = []byte(ca)
+	}
+	if config.ClientCertSecret != "" {
+		secret := &corev1.Secret{}
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: deployment.Namespace, Name: config.ClientCertSecret}, secret)
+		if err != nil {
+			return "", 0, nil, fmt.Errorf("Failed to get client certificate secret %s: %v", config.ClientCertSecret, err)
+		}
+		tlsConfig.Cert = secret.Data[corev1.TLSCertKey]
+		tlsConfig.Key = secret.Data[corev1.TLSPrivateKeyKey]
+		if len(tlsConfig.Cert) == 0 || len(tlsConfig.Key) == 0 {
+			return "", 0, nil, fmt.Errorf("No %s or %s in client certificate secret %s", corev1.TLSCertKey, corev1.TLSPrivateKeyKey, config.ClientCertSecret)
+		}
+	}
+	return openwrt.SchemeHTTPS, config.Port, tlsConfig, nil
+}
+
+// ReferencedObjects returns the names of the Secrets and ConfigMaps which the credentials and
+// transport annotations of the cnf refer to, so that the CRs are applied again when they change
+func ReferencedObjects(deployment extensionsv1beta1.Deployment) ([]string, []string) {
+	var secrets, configMaps []string
+	if name, ok := deployment.Annotations[credentialsAnnotation]; ok {
+		secrets = append(secrets, name)
+	}
+	config := TransportConfig{}
+	if json.Unmarshal([]byte(deployment.Annotations[transportAnnotation]), &config) != nil {
+		return secrets, configMaps
+	}
+	for _, name := range []string{config.CASecret, config.ClientCertSecret} {
+		if name != "" {
+			secrets = append(secrets, name)
+		}
+	}
+	if config.CAConfigMap != "" {
+		configMaps = append(configMaps, config.CAConfigMap)
+	}
+	return secrets, configMaps
+}
@@ -0,0 +1,104 @@
+package cnfprovider
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sdewan.akraino.org/sdewan/openwrt"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newCnfDeployment(annotations map[string]string) extensionsv1beta1.Deployment {
+	return extensionsv1beta1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cnf", Namespace: "default", Annotations: annotations}}
+}
+
+func newSecret(name string, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}, Data: map[string][]byte{}}
+	for key, value := range data {
+		secret.Data[key] = []byte(value)
+	}
+	return secret
+}
+
+func TestGetTransport(t *testing.T) {
+	objects := []runtime.Object{
+		newSecret("ca", map[string]string{"ca.crt": "secret-ca", "other.crt": "other-ca"}),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "default"}, Data: map[string]string{"ca.crt": "configmap-ca"}},
+		newSecret("client", map[string]string{corev1.TLSCertKey: "cert", corev1.TLSPrivateKeyKey: "key"}),
+		newSecret("no-key", map[string]string{corev1.TLSCertKey: "cert"}),
+	}
+	tests := []struct {
+		name       string
+		annotation string
+		wantScheme string
+		wantPort   int
+		wantTLS    *openwrt.TLSConfig
+		wantErr    bool
+	}{
+		{name: "no annotation", wantScheme: openwrt.SchemeHTTP},
+		{name: "http", annotation: `{"port": 8080}`, wantScheme: openwrt.SchemeHTTP, wantPort: 8080},
+		{name: "unsupported scheme", annotation: `{"scheme": "ftp"}`, wantErr: true},
+		{name: "invalid annotation", annotation: `{"scheme": `, wantErr: true},
+		{name: "system CAs", annotation: `{"scheme": "https"}`, wantScheme: openwrt.SchemeHTTPS, wantTLS: &openwrt.TLSConfig{}},
+		{name: "CA from a Secret", annotation: `{"scheme": "https", "port": 8443, "caSecret": "ca"}`,
+			wantScheme: openwrt.SchemeHTTPS, wantPort: 8443, wantTLS: &openwrt.TLSConfig{CA: []byte("secret-ca")}},
+		{name: "CA from another key", annotation: `{"scheme": "https", "caSecret": "ca", "caKey": "other.crt"}`,
+			wantScheme: openwrt.SchemeHTTPS, wantTLS: &openwrt.TLSConfig{CA: []byte("other-ca")}},
+		{name: "CA from a ConfigMap", annotation: `{"scheme": "https", "caConfigMap": "ca"}`,
+			wantScheme: openwrt.SchemeHTTPS, wantTLS: &openwrt.TLSConfig{CA: []byte("configmap-ca")}},
+		{name: "no CA key", annotation: `{"scheme": "https", "caConfigMap": "ca", "caKey": "other.crt"}`, wantErr: true},
+		{name: "no CA Secret", annotation: `{"scheme": "https", "caSecret": "missing"}`, wantErr: true},
+		{name: "client certificate", annotation: `{"scheme": "https", "clientCertSecret": "client", "serverName": "cnf.sdewan"}`,
+			wantScheme: openwrt.SchemeHTTPS, wantTLS: &openwrt.TLSConfig{Cert: []byte("cert"), Key: []byte("key"), ServerName: "cnf.sdewan"}},
+		{name: "client certificate without key", annotation: `{"scheme": "https", "clientCertSecret": "no-key"}`, wantErr: true},
+		{name: "insecure", annotation: `{"scheme": "https", "insecureSkipVerify": true}`,
+			wantScheme: openwrt.SchemeHTTPS, wantTLS: &openwrt.TLSConfig{InsecureSkipVerify: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			annotations := map[string]string{}
+			if test.annotation != "" {
+				annotations[transportAnnotation] = test.annotation
+			}
+			scheme, port, tlsConfig, err := getTransport(fake.NewFakeClient(objects...), newCnfDeployment(annotations))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if scheme != test.wantScheme || port != test.wantPort {
+				t.Errorf("got %s port %d, want %s port %d", scheme, port, test.wantScheme, test.wantPort)
+			}
+			if !reflect.DeepEqual(tlsConfig, test.wantTLS) {
+				t.Errorf("got TLS %+v, want %+v", tlsConfig, test.wantTLS)
+			}
+		})
+	}
+}
+
+func TestClientChangesWithTransport(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{PodIP: "10.0.3.1"}}
+	base := &OpenWrtProvider{User: "root", Scheme: openwrt.SchemeHTTPS, TLS: &openwrt.TLSConfig{CA: []byte("ca")}}
+	tests := []struct {
+		name       string
+		provider   OpenWrtProvider
+		wantChange bool
+	}{
+		{name: "same transport", provider: OpenWrtProvider{User: "root", Scheme: openwrt.SchemeHTTPS, TLS: &openwrt.TLSConfig{CA: []byte("ca")}}},
+		{name: "renewed CA", provider: OpenWrtProvider{User: "root", Scheme: openwrt.SchemeHTTPS, TLS: &openwrt.TLSConfig{CA: []byte("new-ca")}}, wantChange: true},
+		{name: "client certificate", provider: OpenWrtProvider{User: "root", Scheme: openwrt.SchemeHTTPS, TLS: &openwrt.TLSConfig{CA: []byte("ca"), Cert: []byte("cert"), Key: []byte("key")}}, wantChange: true},
+		{name: "insecure", provider: OpenWrtProvider{User: "root", Scheme: openwrt.SchemeHTTPS, TLS: &openwrt.TLSConfig{CA: []byte("ca"), InsecureSkipVerify: true}}, wantChange: true},
+		{name: "port", provider: OpenWrtProvider{User: "root", Scheme: openwrt.SchemeHTTPS, Port: 8443, TLS: &openwrt.TLSConfig{CA: []byte("ca")}}, wantChange: true},
+		{name: "http", provider: OpenWrtProvider{User: "root", Scheme: openwrt.SchemeHTTP}, wantChange: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := openwrt.GetOpenwrtClient(*base.getClientInfo(pod))
+			if changed := openwrt.GetOpenwrtClient(*test.provider.getClientInfo(pod)) != old; changed != test.wantChange {
+				t.Errorf("got a new client %v, want %v", changed, test.wantChange)
+			}
+		})
+	}
+}
@@ -2,35 +2,29 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
+	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
 	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
 	"sdewan.akraino.org/sdewan/cnfprovider"
 )
 
-type ISdewanHandler interface {
-	GetType() string
-	GetName(instance runtime.Object)
-	GetFinalizer() string
-	GetInstance(r client.Client, ctx Context, req ctrl.Request) (runtime.Object, error)
-	Convert(o runtime.Object, deployment extensionsv1beta1.Deployment) (IOpenWrtObject, error)
-	IsEqual(instance1 IOpenWrtObject, instance2 IOpenWrtObject) bool
-	GetObject(clientInfo *openwrt.OpenwrtClientInfo, name string) (IOpenWrtObject, error)
-	CreateObject(clientInfo *OpenwrtClientInfo, instance IOpenWrtObject) (IOpenWrtObject, error)
-	UpdateObject(clientInfo *OpenwrtClientInfo, instance IOpenWrtObject) (IOpenWrtObject, error)
-	DeleteObject(clientInfo *OpenwrtClientInfo, name string) error
-	Restart(clientInfo *OpenwrtClientInfo) (bool, error)
-}
-
 // Helper functions to check and remove string from a slice of strings.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
@@ -58,11 +52,10 @@ func getPurpose(instance runtime.Object) string {
 	return labels["sdewanPurpose"]
 }
 
-func getDeletionTempstamp(instance runtime.Object) *time.Time {
-	// to do: time.Time
+func getDeletionTempstamp(instance runtime.Object) *metav1.Time {
 	value := reflect.ValueOf(instance)
 	field := reflect.Indirect(value).FieldByName("DeletionTimestamp")
-	return field.Interface().(*time.Time)
+	return field.Interface().(*metav1.Time)
 }
 
 func getFinalizers(instance runtime.Object) []string {
@@ -71,23 +64,168 @@ func getFinalizers(instance runtime.Object) []string {
 	return field.Interface().([]string)
 }
 
-func setStatus(instance runtime.Object, t *metav1.Time, isSync bool) {
+func getStatus(instance runtime.Object) batchv1alpha1.SdewanStatus {
+	value := reflect.ValueOf(instance)
+	field := reflect.Indirect(value).FieldByName("Status")
+	return field.Interface().(batchv1alpha1.SdewanStatus)
+}
+
+func getResourceVersion(instance runtime.Object) string {
+	value := reflect.ValueOf(instance)
+	field := reflect.Indirect(value).FieldByName("ResourceVersion")
+	return field.Interface().(string)
+}
+
+func getGeneration(instance runtime.Object) int64 {
+	value := reflect.ValueOf(instance)
+	field := reflect.Indirect(value).FieldByName("Generation")
+	return field.Interface().(int64)
+}
+
+func putStatus(instance runtime.Object, status *batchv1alpha1.SdewanStatus) {
 	value := reflect.ValueOf(instance)
-	field_rv := reflect.Indirect(value).FieldByName("ResourceVersion")
-	rv := field_rv.Interface().(string)
 	field_status := reflect.Indirect(value).FieldByName("Status")
-	status := field_status.Interface().(SdewanStatus)
-	status.AppliedVersion = rv
-	status.AppliedTime = t
-	status.InSync = isSync
-	field_status.Set(reflect.ValueOf(status))
+	field_status.Set(reflect.ValueOf(*status))
+}
+
+// setCondition adds or updates a condition. The transition time only changes with the condition status
+func setCondition(status *batchv1alpha1.SdewanStatus, generation int64, condType string, condStatus corev1.ConditionStatus, reason string, message string, t metav1.Time) {
+	for i := range status.Conditions {
+		cond := &status.Conditions[i]
+		if cond.Type != condType {
+			continue
+		}
+		if cond.Status != condStatus {
+			cond.LastTransitionTime = t
+		}
+		cond.Status = condStatus
+		cond.ObservedGeneration = generation
+		cond.Reason = reason
+		cond.Message = message
+		return
+	}
+	status.Conditions = append(status.Conditions, batchv1alpha1.SdewanCondition{
+		Type:               condType,
+		Status:             condStatus,
+		ObservedGeneration: generation,
+		LastTransitionTime: t,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setApplyConditions sets the Ready/Applied/Degraded conditions from the results of the pods.
+// Applied is the result of the last apply to the ready pods, while Ready also needs all the
+// replicas of the cnf to be ready and the service actions of the change to be confirmed.
+func setApplyConditions(status *batchv1alpha1.SdewanStatus, generation int64, results []cnfprovider.PodResult, err error, replicas int32, t metav1.Time) {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	switch {
+	case err != nil:
+		setCondition(status, generation, batchv1alpha1.ConditionApplied, corev1.ConditionFalse, "ApplyFailed", err.Error(), t)
+		setCondition(status, generation, batchv1alpha1.ConditionReady, corev1.ConditionFalse, "ApplyFailed", err.Error(), t)
+		if failed > 0 && failed < len(results) {
+			setCondition(status, generation, batchv1alpha1.ConditionDegraded, corev1.ConditionTrue, "PartiallyApplied",
+				fmt.Sprintf("Applied to %d of %d pods", len(results)-failed, len(results)), t)
+		} else {
+			setCondition(status, generation, batchv1alpha1.ConditionDegraded, corev1.ConditionFalse, "ApplyFailed", "", t)
+		}
+		return
+	case len(results) == 0:
+		setCondition(status, generation, batchv1alpha1.ConditionApplied, corev1.ConditionFalse, "CnfNotReady", "No ready cnf pod", t)
+		setCondition(status, generation, batchv1alpha1.ConditionReady, corev1.ConditionFalse, "CnfNotReady", "No ready cnf pod", t)
+		setCondition(status, generation, batchv1alpha1.ConditionDegraded, corev1.ConditionFalse, "CnfNotReady", "", t)
+		return
+	}
+	message := fmt.Sprintf("Applied to %d pods", len(results))
+	setCondition(status, generation, batchv1alpha1.ConditionApplied, corev1.ConditionTrue, "Applied", message, t)
+	setCondition(status, generation, batchv1alpha1.ConditionDegraded, corev1.ConditionFalse, "Applied", "", t)
+	switch {
+	case hasPendingAction(results):
+		setCondition(status, generation, batchv1alpha1.ConditionReady, corev1.ConditionFalse, "ServiceActionPending", "Waiting for the service action of the change", t)
+	case int32(len(results)) < replicas:
+		setCondition(status, generation, batchv1alpha1.ConditionReady, corev1.ConditionFalse, "PodsNotReady",
+			fmt.Sprintf("Applied to %d of %d pods, the others get it once they are ready", len(results), replicas), t)
+	default:
+		setCondition(status, generation, batchv1alpha1.ConditionReady, corev1.ConditionTrue, "Applied", message, t)
+	}
+}
+
+// updatePodStatus merges the results into the pod list. The pods without result are removed,
+// and the entry of a pod only changes when the apply to the pod did something
+func updatePodStatus(status *batchv1alpha1.SdewanStatus, results []cnfprovider.PodResult, version string, generation int64, t *metav1.Time) {
+	var pods []batchv1alpha1.SdewanPodStatus
+	for _, result := range results {
+		pod := batchv1alpha1.SdewanPodStatus{Name: result.Name}
+		for _, old := range status.Pods {
+			if old.Name == result.Name {
+				pod = old
+				break
+			}
+		}
+		pod.IP = result.Ip
+		if result.Action != "" {
+			pod.ServiceAction = result.Action
+		}
+		if result.Err != nil {
+			pod.LastError = result.Err.Error()
+			pod.LastUpdateTime = t
+			if result.Reverted {
+				pod.RevertedGeneration = generation
+			}
+		} else if result.Changed || pod.AppliedGeneration != generation || pod.LastError != "" || pod.Key != result.Key {
+			pod.Key = result.Key
+			pod.AppliedVersion = version
+			pod.AppliedGeneration = generation
+			pod.LastError = ""
+			pod.RevertedGeneration = 0
+			pod.LastUpdateTime = t
+		}
+		pods = append(pods, pod)
+	}
+	status.Pods = pods
+}
+
+// hasPendingAction checks if the service action of a pod change is scheduled and not confirmed yet
+func hasPendingAction(results []cnfprovider.PodResult) bool {
+	for _, result := range results {
+		if result.Pending {
+			return true
+		}
+	}
+	return false
+}
+
+// setLastKnownGood saves the spec in the last known good annotation, and returns whether it changed
+func setLastKnownGood(instance runtime.Object) bool {
+	value := reflect.ValueOf(instance)
+	spec, err := json.Marshal(reflect.Indirect(value).FieldByName("Spec").Interface())
+	if err != nil {
+		return false
+	}
+	field := reflect.Indirect(value).FieldByName("ObjectMeta")
+	base_obj := field.Interface().(metav1.ObjectMeta)
+	if base_obj.Annotations[cnfprovider.LastKnownGoodAnnotation] == string(spec) {
+		return false
+	}
+	annotations := map[string]string{}
+	for k, v := range base_obj.Annotations {
+		annotations[k] = v
+	}
+	annotations[cnfprovider.LastKnownGoodAnnotation] = string(spec)
+	base_obj.Annotations = annotations
+	field.Set(reflect.ValueOf(base_obj))
+	return true
 }
 
 func appendFinalizer(instance runtime.Object, item string) {
-	// to do: ObjectMeta
 	value := reflect.ValueOf(instance)
 	field := reflect.Indirect(value).FieldByName("ObjectMeta")
-	base_obj := field.Interface().(ObjectMeta)
+	base_obj := field.Interface().(metav1.ObjectMeta)
 	base_obj.Finalizers = append(base_obj.Finalizers, item)
 	field.Set(reflect.ValueOf(base_obj))
 }
@@ -95,7 +233,7 @@ func appendFinalizer(instance runtime.Object, item string) {
 func removeFinalizer(instance runtime.Object, item string) {
 	value := reflect.ValueOf(instance)
 	field := reflect.Indirect(value).FieldByName("ObjectMeta")
-	base_obj := field.Interface().(ObjectMeta)
+	base_obj := field.Interface().(metav1.ObjectMeta)
 	base_obj.Finalizers = removeString(base_obj.Finalizers, item)
 	field.Set(reflect.ValueOf(base_obj))
 }
@@ -121,14 +259,56 @@ func net2iface(net string, deployment extensionsv1beta1.Deployment) (string, err
 			return iface.Interface, nil
 		}
 	}
-	return "", errors.New(fmt.Sprintf("No matched network in annotation: %s", net))
+	return "", fmt.Errorf("No matched network in annotation: %s", net)
 
 }
 
+// read the value of a secret key, so that key material is never kept in the CR itself
+func getSecretValue(r client.Client, namespace string, selector *corev1.SecretKeySelector) (string, error) {
+	if selector == nil {
+		return "", nil
+	}
+	secret := &corev1.Secret{}
+	err := r.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: selector.Name}, secret)
+	if err != nil {
+		if errors.IsNotFound(err) && selector.Optional != nil && *selector.Optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("Failed to get secret %s: %v", selector.Name, err)
+	}
+	value, ok := secret.Data[selector.Key]
+	if !ok {
+		if selector.Optional != nil && *selector.Optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("No key %s in secret %s", selector.Key, selector.Name)
+	}
+	return string(value), nil
+}
+
+// checkPortRange checks that a port range of the CR, e.g. 1000-2000, is not reversed, which the CRD
+// pattern can't check. The CRs created before the pattern was tightened are checked too.
+func checkPortRange(field string, value string) error {
+	if value == "" {
+		return nil
+	}
+	ports := strings.SplitN(value, "-", 2)
+	first, err := strconv.Atoi(ports[0])
+	last := first
+	if err == nil && len(ports) == 2 {
+		last, err = strconv.Atoi(ports[1])
+	}
+	if err != nil || first < 1 || last > 65535 || first > last {
+		return fmt.Errorf("Invalid %s %s: it must be a port or a range of ports from 1 to 65535", field, value)
+	}
+	return nil
+}
+
 // Common Reconcile Processing
-func ProcessReconcile(r client.Client, logger logr.Logge, req ctrl.Request, handler ISdewanHandler) (ctrl.Result, error) {
+func ProcessReconcile(r *SdewanReconciler, req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
-	log := logger.WithValues(handler.GetType(), req.NamespacedName)
+	handler := r.Handler
+	log := r.Log.WithValues(handler.GetType(), req.NamespacedName)
 
 	// your logic here
 	during, _ := time.ParseDuration("5s")
@@ -147,54 +327,119 @@ func ProcessReconcile(r client.Client, logger logr.Logge, req ctrl.Request, hand
 	// cnf, err := cnfprovider.NewWrt(req.NamespacedName.Namespace, instance.Labels["sdewanPurpose"], r.Client)
 	// Labels: map[string]string
 	purpose := getPurpose(instance)
-	cnf, err := cnfprovider.NewOpenWrt(req.NamespacedName.Namespace, purpose, r)
+	cnf, err := cnfprovider.NewOpenWrt(req.NamespacedName.Namespace, purpose, r.Client)
 	if err != nil {
 		log.Error(err, "Failed to get cnf")
 		// A new event are supposed to be received upon cnf ready
 		// so not requeue
 		return ctrl.Result{}, nil
 	}
+	if cnf != nil {
+		cnf.OnServiceAction = func(err error) {
+			if err != nil {
+				r.Recorder.Event(instance, corev1.EventTypeWarning, "ServiceActionFailed", err.Error())
+			}
+			// the CR is reconciled again to run the failed action again, or to confirm the applied spec
+			r.requeueInstance(instance)
+		}
+	}
 	// finalizerName := "rule.finalizers.sdewan.akraino.org"
 	finalizerName := handler.GetFinalizer()
+	generation := getGeneration(instance)
+	oldStatus := getStatus(instance)
+	status := oldStatus.DeepCopy()
+	now := metav1.Now()
 	// if instance.ObjectMeta.DeletionTimestamp.IsZero() {
 	// DeletionTimestamp: *Time
 	delete_timestamp := getDeletionTempstamp(instance)
+	if cnf != nil && (r.Options.DryRun || isAnnotated(instance, dryRunAnnotation)) {
+		return r.planReconcile(ctx, instance, cnf, !delete_timestamp.IsZero(), false, &oldStatus, status, now)
+	}
+	if cnf != nil && (cnf.IsPaused() || isAnnotated(instance, cnfprovider.PausedAnnotation)) {
+		return r.planReconcile(ctx, instance, cnf, !delete_timestamp.IsZero(), true, &oldStatus, status, now)
+	}
+	// the plan is only kept in dry run or pause
+	status.Plan = nil
+	if hasCondition(status, batchv1alpha1.ConditionPaused) {
+		setCondition(status, generation, batchv1alpha1.ConditionPaused, corev1.ConditionFalse, "Resumed", "", now)
+	}
 	if delete_timestamp.IsZero() {
 		// creating or updating CR
 		if cnf == nil {
 			// no cnf exists
 			log.Info("No cnf exist, so not create/update " + handler.GetType())
-			return ctrl.Result{}, nil
+			status.InSync = false
+			status.Pods = nil
+			setCondition(status, generation, batchv1alpha1.ConditionApplied, corev1.ConditionFalse, "NoCnf", "No cnf with sdewanPurpose "+purpose, now)
+			setCondition(status, generation, batchv1alpha1.ConditionReady, corev1.ConditionFalse, "NoCnf", "No cnf with sdewanPurpose "+purpose, now)
+			setCondition(status, generation, batchv1alpha1.ConditionDegraded, corev1.ConditionFalse, "NoCnf", "", now)
+			return ctrl.Result{}, r.updateStatus(instance, &oldStatus, status)
 		}
-		changed, err := cnf.AddOrUpdateObject(handler, instance)
+		// the CR is applied already, so a change from now on is a repair of drifted runtime config
+		applied := oldStatus.InSync && oldStatus.AppliedGeneration == generation
+		changed, results, err := cnf.AddOrUpdateObject(ctx, handler, instance, getRetrySkipPods(&oldStatus, generation), getRevertedPods(&oldStatus, generation))
+		setApplyConditions(status, generation, results, err, cnf.Deployment.Status.Replicas, now)
 		if err != nil {
 			log.Error(err, "Failed to add/update "+handler.GetType())
+			updatePodStatus(status, results, getResourceVersion(instance), generation, &now)
+			status.InSync = false
+			if err := r.updateStatus(instance, &oldStatus, status); err != nil {
+				log.Error(err, "Failed to update status for "+handler.GetType())
+			}
+			if isHeld(results) {
+				// a retry would only revert the change again, a new generation is applied right away
+				return ctrl.Result{RequeueAfter: r.Options.ResyncInterval}, nil
+			}
 			return ctrl.Result{RequeueAfter: during}, nil
 		}
 		// if !containsString(instance.ObjectMeta.Finalizers, finalizerName) {
 		// Finalizers: []string
 		finalizers := getFinalizers(instance)
+		needUpdate := false
 		if !containsString(finalizers, finalizerName) {
 			log.Info("Adding finalizer for " + handler.GetType())
 			// instance.ObjectMeta.Finalizers = append(instance.ObjectMeta.Finalizers, finalizerName)
 			// Finalizers: []string
 			appendFinalizer(instance, finalizerName)
+			needUpdate = true
+		}
+		// the spec is applied to all the pods, so it's the last known good one to restore on failures.
+		// A scheduled service action may still fail, so the spec is saved once the action is confirmed.
+		if len(results) > 0 && !hasPendingAction(results) && setLastKnownGood(instance) {
+			needUpdate = true
+		}
+		if needUpdate {
 			if err := r.Update(ctx, instance); err != nil {
 				return ctrl.Result{}, err
 			}
 		}
-		if changed {
+		// the version is read after the finalizer update, so that it matches the CR next time
+		version := getResourceVersion(instance)
+		updatePodStatus(status, results, version, generation, &now)
+		if len(results) == 0 {
+			// nothing is applied without a ready pod
+			status.InSync = false
+		} else if changed || !applied {
 			// instance.Status.AppliedVersion = instance.ResourceVersion
 			// instance.Status.AppliedTime = &metav1.Time{Time: time.Now()}
 			// instance.Status.InSync = true
-			// Status: SdewanStatus
-			setStatus(instance, &metav1.Time{Time: time.Now()}, true)
-			err = r.Status().Update(ctx, instance)
-			if err != nil {
-				log.Error(err, "Failed to update status for "+handler.GetType())
-				return ctrl.Result{}, err
+			if changed && applied {
+				log.Info("Repaired drift of " + handler.GetType())
+				r.Recorder.Eventf(instance, corev1.EventTypeWarning, "DriftRepaired",
+					"Runtime config of cnf %s differed from the CR and was applied again", cnf.Deployment.Name)
+				status.LastDriftTime = &now
 			}
+			status.AppliedVersion = version
+			status.AppliedGeneration = generation
+			status.AppliedTime = &now
+			status.InSync = true
+		}
+		if err := r.updateStatus(instance, &oldStatus, status); err != nil {
+			log.Error(err, "Failed to update status for "+handler.GetType())
+			return ctrl.Result{}, err
 		}
+		// check the runtime config again after the resync interval
+		return ctrl.Result{RequeueAfter: r.Options.ResyncInterval}, nil
 	} else {
 		// deletin CR
 		if cnf == nil {
@@ -210,9 +455,14 @@ func ProcessReconcile(r client.Client, logger logr.Logge, req ctrl.Request, hand
 			return ctrl.Result{}, nil
 		}
 		//_, err := cnf.DeleteMwan3Policy(instance)
-		_, err := cnf.DeleteObject(handler, instance)
+		_, results, err := cnf.DeleteObject(ctx, handler, instance)
 		if err != nil {
 			log.Error(err, "Failed to delete "+handler.GetType())
+			updatePodStatus(status, results, status.AppliedVersion, status.AppliedGeneration, &now)
+			setCondition(status, generation, batchv1alpha1.ConditionReady, corev1.ConditionFalse, "DeleteFailed", err.Error(), now)
+			if err := r.updateStatus(instance, &oldStatus, status); err != nil {
+				log.Error(err, "Failed to update status for "+handler.GetType())
+			}
 			return ctrl.Result{RequeueAfter: during}, nil
 		}
 		// if containsString(instance.ObjectMeta.Finalizers, finalizerName) {
@@ -228,3 +478,143 @@ func ProcessReconcile(r client.Client, logger logr.Logge, req ctrl.Request, hand
 
 	return ctrl.Result{}, nil
 }
+
+// The annotation to run a CR in dry run, as the --dry-run flag does for all the CRs
+const dryRunAnnotation = "sdewan.akraino.org/dry-run"
+
+func isAnnotated(instance runtime.Object, annotation string) bool {
+	value := reflect.ValueOf(instance)
+	field := reflect.Indirect(value).FieldByName("Annotations")
+	annotations := field.Interface().(map[string]string)
+	return annotations[annotation] == "true"
+}
+
+func hasCondition(status *batchv1alpha1.SdewanStatus, condType string) bool {
+	for _, cond := range status.Conditions {
+		if cond.Type == condType {
+			return true
+		}
+	}
+	return false
+}
+
+// planReconcile computes the changes to the cnf into the status and an Event, without applying them.
+// A paused CR also reports the drift of its applied config. A CR being deleted keeps its finalizer,
+// so the deletion waits until the dry run or the pause is over.
+func (r *SdewanReconciler) planReconcile(ctx context.Context, instance runtime.Object, cnf *cnfprovider.OpenWrtProvider, isDelete bool, paused bool, oldStatus *batchv1alpha1.SdewanStatus, status *batchv1alpha1.SdewanStatus, now metav1.Time) (ctrl.Result, error) {
+	handler := r.Handler
+	log := r.Log.WithValues(handler.GetType(), handler.GetName(instance))
+	plan, err := cnf.PlanObject(ctx, handler, instance, isDelete)
+	if err != nil {
+		log.Error(err, "Failed to plan "+handler.GetType())
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+	status.Plan = plan
+	reason := "DryRun"
+	if paused {
+		reason = "Paused"
+		setCondition(status, getGeneration(instance), batchv1alpha1.ConditionPaused, corev1.ConditionTrue, reason, "Changes to cnf "+cnf.Deployment.Name+" are paused", now)
+	}
+	var msgs []string
+	changed := false
+	for _, podPlan := range plan {
+		if podPlan.Action != batchv1alpha1.PlanActionNone {
+			changed = true
+		}
+		msg := podPlan.Pod + ": " + podPlan.Action
+		if len(podPlan.Diff) > 0 {
+			msg += " (" + strings.Join(podPlan.Diff, ", ") + ")"
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		msgs = append(msgs, "no ready cnf pod")
+	}
+	if !reflect.DeepEqual(oldStatus.Plan, status.Plan) {
+		r.Recorder.Event(instance, corev1.EventTypeNormal, reason, "Plan for cnf "+cnf.Deployment.Name+": "+strings.Join(msgs, "; "))
+	}
+	if paused && changed {
+		if oldStatus.InSync && !isDelete {
+			r.Recorder.Event(instance, corev1.EventTypeWarning, "DriftDetected", "Drift of cnf "+cnf.Deployment.Name+" is not repaired while paused: "+strings.Join(msgs, "; "))
+			status.LastDriftTime = &now
+		}
+		status.InSync = false
+	}
+	if err := r.updateStatus(instance, oldStatus, status); err != nil {
+		log.Error(err, "Failed to update status for "+handler.GetType())
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.Options.ResyncInterval}, nil
+}
+
+// requeueInstance reconciles a CR again, which runs the failed service action of a pod again
+func (r *SdewanReconciler) requeueInstance(instance runtime.Object) {
+	accessor, err := meta.Accessor(instance)
+	if err != nil {
+		return
+	}
+	select {
+	case r.requeue <- event.GenericEvent{Meta: accessor, Object: instance}:
+	default:
+		// the queue is full, the CR is reconciled again by the resync
+	}
+}
+
+// getRetrySkipPods returns the keys of the pods which don't need a retry, as the CR was applied to them
+// while it failed on the other pods. A pod whose containers restarted since has a new key, so it is not
+// skipped. Nothing is skipped if no pod failed, so that the drift of all pods is checked.
+func getRetrySkipPods(status *batchv1alpha1.SdewanStatus, generation int64) []string {
+	failed := false
+	for _, pod := range status.Pods {
+		if pod.LastError != "" {
+			failed = true
+		}
+	}
+	if !failed {
+		return nil
+	}
+	var pods []string
+	for _, pod := range status.Pods {
+		if pod.LastError == "" && pod.AppliedGeneration == generation && pod.Key != "" {
+			pods = append(pods, pod.Key)
+		}
+	}
+	return pods
+}
+
+// getRevertedPods returns the names of the pods the generation was reverted on after a failed health check
+func getRevertedPods(status *batchv1alpha1.SdewanStatus, generation int64) []string {
+	var pods []string
+	for _, pod := range status.Pods {
+		if pod.RevertedGeneration == generation {
+			pods = append(pods, pod.Name)
+		}
+	}
+	return pods
+}
+
+// isHeld checks if the failed pods are only the ones the change was reverted on, and the ones
+// left by the stopped rollout, so that the change fails the same way until the spec changes
+func isHeld(results []cnfprovider.PodResult) bool {
+	held := false
+	for _, result := range results {
+		switch {
+		case result.Err == nil:
+		case result.Reverted:
+			held = true
+		case stderrors.Is(result.Err, cnfprovider.ErrRolloutStopped):
+		default:
+			return false
+		}
+	}
+	return held
+}
+
+// updateStatus writes the status of the CR only when it differs from the old status
+func (r *SdewanReconciler) updateStatus(instance runtime.Object, oldStatus *batchv1alpha1.SdewanStatus, status *batchv1alpha1.SdewanStatus) error {
+	if reflect.DeepEqual(oldStatus, status) {
+		return nil
+	}
+	putStatus(instance, status)
+	return r.Status().Update(context.Background(), instance)
+}
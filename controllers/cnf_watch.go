@@ -0,0 +1,160 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"sdewan.akraino.org/sdewan/cnfprovider"
+)
+
+// The CNF config is lost when a CNF pod restarts, so every controller watches the
+// CNF Deployments and Pods and re-pushes its CRs when the ready status changes. The CRs
+// are also re-pushed when the Secrets and ConfigMaps of the CNF credentials and transport change.
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=extensions,resources=deployments,verbs=get;list;watch
+
+// cnfDeploymentPredicate passes the CNF Deployment updates which change the number of ready replicas
+// or the paused annotation, so that the CRs are applied right after a pause
+var cnfDeploymentPredicate = predicate.Funcs{
+	CreateFunc:  func(e event.CreateEvent) bool { return false },
+	DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+	GenericFunc: func(e event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.MetaNew.GetLabels()["sdewanPurpose"] == "" {
+			return false
+		}
+		oldDeployment, ok1 := e.ObjectOld.(*extensionsv1beta1.Deployment)
+		newDeployment, ok2 := e.ObjectNew.(*extensionsv1beta1.Deployment)
+		if !ok1 || !ok2 {
+			return false
+		}
+		return oldDeployment.Status.ReadyReplicas != newDeployment.Status.ReadyReplicas ||
+			oldDeployment.Annotations[cnfprovider.PausedAnnotation] != newDeployment.Annotations[cnfprovider.PausedAnnotation]
+	},
+}
+
+// cnfPodPredicate passes the CNF Pod updates which change the ready condition
+var cnfPodPredicate = predicate.Funcs{
+	CreateFunc:  func(e event.CreateEvent) bool { return false },
+	DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+	GenericFunc: func(e event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.MetaNew.GetLabels()["sdewanPurpose"] == "" {
+			return false
+		}
+		oldPod, ok1 := e.ObjectOld.(*corev1.Pod)
+		newPod, ok2 := e.ObjectNew.(*corev1.Pod)
+		if !ok1 || !ok2 {
+			return false
+		}
+		return cnfprovider.IsPodReady(oldPod) != cnfprovider.IsPodReady(newPod)
+	},
+}
+
+// listCRs lists the CRs of the kind of object targeting the sdewanPurpose in a namespace
+func listCRs(r client.Client, scheme *runtime.Scheme, object runtime.Object, namespace string, purpose string) ([]runtime.Object, error) {
+	gvks, _, err := scheme.ObjectKinds(object)
+	if err != nil {
+		return nil, err
+	}
+	listGvk := gvks[0]
+	listGvk.Kind = listGvk.Kind + "List"
+	list, err := scheme.New(listGvk)
+	if err != nil {
+		return nil, err
+	}
+	err = r.List(context.Background(), list, client.InNamespace(namespace), client.MatchingLabels{"sdewanPurpose": purpose})
+	if err != nil {
+		return nil, err
+	}
+	return meta.ExtractList(list)
+}
+
+// cnfToRequests returns a mapper which enqueues all the CRs of the kind of object
+// targeting the sdewanPurpose of the changed CNF
+func cnfToRequests(r client.Client, scheme *runtime.Scheme, object runtime.Object) handler.ToRequestsFunc {
+	log := ctrl.Log.WithName("controllers").WithName("CnfWatch")
+	return func(o handler.MapObject) []reconcile.Request {
+		purpose := o.Meta.GetLabels()["sdewanPurpose"]
+		items, err := listCRs(r, scheme, object, o.Meta.GetNamespace(), purpose)
+		if err != nil {
+			log.Error(err, "Failed to list CRs for cnf", "sdewanPurpose", purpose)
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, item := range items {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				continue
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()},
+			})
+		}
+		return requests
+	}
+}
+
+// cnfReferenceToRequests returns a mapper which enqueues all the CRs of the kind of object
+// targeting the CNFs which read their credentials or transport from the changed Secret or ConfigMap
+func cnfReferenceToRequests(r client.Client, scheme *runtime.Scheme, object runtime.Object) handler.ToRequestsFunc {
+	log := ctrl.Log.WithName("controllers").WithName("CnfWatch")
+	toRequests := cnfToRequests(r, scheme, object)
+	return func(o handler.MapObject) []reconcile.Request {
+		_, isSecret := o.Object.(*corev1.Secret)
+		deployments := &extensionsv1beta1.DeploymentList{}
+		err := r.List(context.Background(), deployments, client.InNamespace(o.Meta.GetNamespace()))
+		if err != nil {
+			log.Error(err, "Failed to list cnf deployments", "namespace", o.Meta.GetNamespace())
+			return nil
+		}
+		var requests []reconcile.Request
+		for i := range deployments.Items {
+			deployment := &deployments.Items[i]
+			if deployment.Labels["sdewanPurpose"] == "" {
+				continue
+			}
+			secrets, configMaps := cnfprovider.ReferencedObjects(*deployment)
+			names := configMaps
+			if isSecret {
+				names = secrets
+			}
+			for _, name := range names {
+				if name == o.Meta.GetName() {
+					requests = append(requests, toRequests(handler.MapObject{Meta: deployment, Object: deployment})...)
+					break
+				}
+			}
+		}
+		return requests
+	}
+}
@@ -0,0 +1,192 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+type FirewallDNATHandler struct {
+}
+
+func (m *FirewallDNATHandler) GetType() string {
+	return "FirewallDNAT"
+}
+
+func (m *FirewallDNATHandler) GetName(instance runtime.Object) string {
+	dnat := instance.(*batchv1alpha1.FirewallDNAT)
+	return m.GetObjectPrefix() + dnat.Name
+}
+
+// the CNF objects with the prefix are owned by the operator
+func (m *FirewallDNATHandler) GetObjectPrefix() string {
+	return "sdwfd_"
+}
+
+func (m *FirewallDNATHandler) GetFinalizer() string {
+	return "firewalldnat.finalizers.sdewan.akraino.org"
+}
+
+func (m *FirewallDNATHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.FirewallDNAT{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+func (m *FirewallDNATHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	dnat := instance.(*batchv1alpha1.FirewallDNAT)
+	src, err := getFirewallZoneName(r, dnat, dnat.Namespace, dnat.Spec.Src)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := getFirewallZoneName(r, dnat, dnat.Namespace, dnat.Spec.Dest)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPortRange("src_port", dnat.Spec.SrcPort); err != nil {
+		return nil, err
+	}
+	if err := checkPortRange("src_dport", dnat.Spec.SrcDPort); err != nil {
+		return nil, err
+	}
+	if err := checkPortRange("dest_port", dnat.Spec.DestPort); err != nil {
+		return nil, err
+	}
+	return &openwrt.SdewanFirewallRedirect{
+		Name:     m.GetName(dnat),
+		Src:      src,
+		SrcIp:    dnat.Spec.SrcIp,
+		SrcDIp:   dnat.Spec.SrcDIp,
+		SrcMac:   dnat.Spec.SrcMac,
+		SrcPort:  dnat.Spec.SrcPort,
+		SrcDPort: dnat.Spec.SrcDPort,
+		Proto:    dnat.Spec.Proto,
+		Dest:     dest,
+		DestIp:   dnat.Spec.DestIp,
+		DestPort: dnat.Spec.DestPort,
+		Mark:     dnat.Spec.Mark,
+		Target:   "DNAT",
+	}, nil
+}
+
+func (m *FirewallDNATHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	dnat1 := instance1.(*openwrt.SdewanFirewallRedirect)
+	dnat2 := instance2.(*openwrt.SdewanFirewallRedirect)
+	return reflect.DeepEqual(*dnat1, *dnat2)
+}
+
+func (m *FirewallDNATHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	ret, err := firewall.GetRedirect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *FirewallDNATHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	dnat := instance.(*openwrt.SdewanFirewallRedirect)
+	return firewall.CreateRedirect(ctx, *dnat)
+}
+
+func (m *FirewallDNATHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	dnat := instance.(*openwrt.SdewanFirewallRedirect)
+	return firewall.UpdateRedirect(ctx, *dnat)
+}
+
+func (m *FirewallDNATHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	return firewall.DeleteRedirect(ctx, name)
+}
+
+func (m *FirewallDNATHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	objs, err := firewall.GetRedirects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Redirects))
+	for i, obj := range objs.Redirects {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+func (m *FirewallDNATHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return nil
+}
+
+func (m *FirewallDNATHandler) GetServiceName() string {
+	return "firewall"
+}
+
+func (m *FirewallDNATHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *FirewallDNATHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewalldnats,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewalldnats/status,verbs=get;update;patch
+
+func init() {
+	Register(&FirewallDNATHandler{}, &batchv1alpha1.FirewallDNAT{},
+		Watch{Object: &batchv1alpha1.FirewallZone{}, Mapper: firewallZoneToDNATs},
+	)
+}
+
+// Enqueue the DNATs which reference the changed FirewallZone in src or dest, so that
+// the openwrt zone name is resolved again when the zone is created or deleted
+func firewallZoneToDNATs(r client.Client, o handler.MapObject) []reconcile.Request {
+	dnats := &batchv1alpha1.FirewallDNATList{}
+	err := r.List(context.Background(), dnats, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		ctrl.Log.WithName("controllers").WithName("FirewallDNAT").Error(err, "Failed to list FirewallDNAT for zone", "zone", o.Meta.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, dnat := range dnats.Items {
+		if dnat.Spec.Src == o.Meta.GetName() || dnat.Spec.Dest == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: dnat.Namespace, Name: dnat.Name},
+			})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,174 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+type FirewallForwardingHandler struct {
+}
+
+func (m *FirewallForwardingHandler) GetType() string {
+	return "FirewallForwarding"
+}
+
+func (m *FirewallForwardingHandler) GetName(instance runtime.Object) string {
+	forwarding := instance.(*batchv1alpha1.FirewallForwarding)
+	return m.GetObjectPrefix() + forwarding.Name
+}
+
+// the CNF objects with the prefix are owned by the operator
+func (m *FirewallForwardingHandler) GetObjectPrefix() string {
+	return "sdwff_"
+}
+
+func (m *FirewallForwardingHandler) GetFinalizer() string {
+	return "firewallforwarding.finalizers.sdewan.akraino.org"
+}
+
+func (m *FirewallForwardingHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.FirewallForwarding{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+func (m *FirewallForwardingHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	forwarding := instance.(*batchv1alpha1.FirewallForwarding)
+	src, err := getFirewallZoneName(r, forwarding, forwarding.Namespace, forwarding.Spec.Src)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := getFirewallZoneName(r, forwarding, forwarding.Namespace, forwarding.Spec.Dest)
+	if err != nil {
+		return nil, err
+	}
+	return &openwrt.SdewanFirewallForwarding{
+		Name:   m.GetName(forwarding),
+		Src:    src,
+		Dest:   dest,
+		Family: forwarding.Spec.Family,
+	}, nil
+}
+
+func (m *FirewallForwardingHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	forwarding1 := instance1.(*openwrt.SdewanFirewallForwarding)
+	forwarding2 := instance2.(*openwrt.SdewanFirewallForwarding)
+	return reflect.DeepEqual(*forwarding1, *forwarding2)
+}
+
+func (m *FirewallForwardingHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	ret, err := firewall.GetForwarding(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *FirewallForwardingHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	forwarding := instance.(*openwrt.SdewanFirewallForwarding)
+	return firewall.CreateForwarding(ctx, *forwarding)
+}
+
+func (m *FirewallForwardingHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	forwarding := instance.(*openwrt.SdewanFirewallForwarding)
+	return firewall.UpdateForwarding(ctx, *forwarding)
+}
+
+func (m *FirewallForwardingHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	return firewall.DeleteForwarding(ctx, name)
+}
+
+func (m *FirewallForwardingHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	objs, err := firewall.GetForwardings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Forwardings))
+	for i, obj := range objs.Forwardings {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+func (m *FirewallForwardingHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return nil
+}
+
+func (m *FirewallForwardingHandler) GetServiceName() string {
+	return "firewall"
+}
+
+func (m *FirewallForwardingHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *FirewallForwardingHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewallforwardings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewallforwardings/status,verbs=get;update;patch
+
+func init() {
+	Register(&FirewallForwardingHandler{}, &batchv1alpha1.FirewallForwarding{},
+		Watch{Object: &batchv1alpha1.FirewallZone{}, Mapper: firewallZoneToForwardings},
+	)
+}
+
+// Enqueue the forwardings which reference the changed FirewallZone, so that a
+// forwarding is re-applied as soon as a deleted zone is re-created
+func firewallZoneToForwardings(r client.Client, o handler.MapObject) []reconcile.Request {
+	forwardings := &batchv1alpha1.FirewallForwardingList{}
+	err := r.List(context.Background(), forwardings, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		ctrl.Log.WithName("controllers").WithName("FirewallForwarding").Error(err, "Failed to list FirewallForwarding for zone", "zone", o.Meta.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, forwarding := range forwardings.Items {
+		if forwarding.Spec.Src == o.Meta.GetName() || forwarding.Spec.Dest == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: forwarding.Namespace, Name: forwarding.Name},
+			})
+		}
+	}
+	return requests
+}
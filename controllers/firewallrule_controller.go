@@ -0,0 +1,185 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+type FirewallRuleHandler struct {
+}
+
+func (m *FirewallRuleHandler) GetType() string {
+	return "FirewallRule"
+}
+
+func (m *FirewallRuleHandler) GetName(instance runtime.Object) string {
+	rule := instance.(*batchv1alpha1.FirewallRule)
+	return m.GetObjectPrefix() + rule.Name
+}
+
+// the CNF objects with the prefix are owned by the operator
+func (m *FirewallRuleHandler) GetObjectPrefix() string {
+	return "sdwfr_"
+}
+
+func (m *FirewallRuleHandler) GetFinalizer() string {
+	return "firewallrule.finalizers.sdewan.akraino.org"
+}
+
+func (m *FirewallRuleHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.FirewallRule{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+func (m *FirewallRuleHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	rule := instance.(*batchv1alpha1.FirewallRule)
+	src, err := getFirewallZoneName(r, rule, rule.Namespace, rule.Spec.Src)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := getFirewallZoneName(r, rule, rule.Namespace, rule.Spec.Dest)
+	if err != nil {
+		return nil, err
+	}
+	return &openwrt.SdewanFirewallRule{
+		Name:     m.GetName(rule),
+		Src:      src,
+		SrcIp:    rule.Spec.SrcIp,
+		SrcMac:   rule.Spec.SrcMac,
+		SrcPort:  rule.Spec.SrcPort,
+		Proto:    rule.Spec.Proto,
+		IcmpType: rule.Spec.IcmpType,
+		Dest:     dest,
+		DestIp:   rule.Spec.DestIp,
+		DestPort: rule.Spec.DestPort,
+		Mark:     rule.Spec.Mark,
+		Target:   rule.Spec.Target,
+		SetMark:  rule.Spec.SetMark,
+		SetXmark: rule.Spec.SetXmark,
+		Family:   rule.Spec.Family,
+	}, nil
+}
+
+func (m *FirewallRuleHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	rule1 := instance1.(*openwrt.SdewanFirewallRule)
+	rule2 := instance2.(*openwrt.SdewanFirewallRule)
+	return reflect.DeepEqual(*rule1, *rule2)
+}
+
+func (m *FirewallRuleHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	ret, err := firewall.GetRule(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *FirewallRuleHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	rule := instance.(*openwrt.SdewanFirewallRule)
+	return firewall.CreateRule(ctx, *rule)
+}
+
+func (m *FirewallRuleHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	rule := instance.(*openwrt.SdewanFirewallRule)
+	return firewall.UpdateRule(ctx, *rule)
+}
+
+func (m *FirewallRuleHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	return firewall.DeleteRule(ctx, name)
+}
+
+func (m *FirewallRuleHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	objs, err := firewall.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Rules))
+	for i, obj := range objs.Rules {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+func (m *FirewallRuleHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return nil
+}
+
+func (m *FirewallRuleHandler) GetServiceName() string {
+	return "firewall"
+}
+
+func (m *FirewallRuleHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *FirewallRuleHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewallrules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewallrules/status,verbs=get;update;patch
+
+func init() {
+	Register(&FirewallRuleHandler{}, &batchv1alpha1.FirewallRule{},
+		Watch{Object: &batchv1alpha1.FirewallZone{}, Mapper: firewallZoneToRules},
+	)
+}
+
+// Enqueue the rules which reference the changed FirewallZone in src or dest, so that
+// the openwrt zone name is resolved again when the zone is created or deleted
+func firewallZoneToRules(r client.Client, o handler.MapObject) []reconcile.Request {
+	rules := &batchv1alpha1.FirewallRuleList{}
+	err := r.List(context.Background(), rules, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		ctrl.Log.WithName("controllers").WithName("FirewallRule").Error(err, "Failed to list FirewallRule for zone", "zone", o.Meta.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, rule := range rules.Items {
+		if rule.Spec.Src == o.Meta.GetName() || rule.Spec.Dest == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: rule.Namespace, Name: rule.Name},
+			})
+		}
+	}
+	return requests
+}
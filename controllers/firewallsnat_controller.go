@@ -0,0 +1,192 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+type FirewallSNATHandler struct {
+}
+
+func (m *FirewallSNATHandler) GetType() string {
+	return "FirewallSNAT"
+}
+
+func (m *FirewallSNATHandler) GetName(instance runtime.Object) string {
+	snat := instance.(*batchv1alpha1.FirewallSNAT)
+	return m.GetObjectPrefix() + snat.Name
+}
+
+// the CNF objects with the prefix are owned by the operator
+func (m *FirewallSNATHandler) GetObjectPrefix() string {
+	return "sdwfs_"
+}
+
+func (m *FirewallSNATHandler) GetFinalizer() string {
+	return "firewallsnat.finalizers.sdewan.akraino.org"
+}
+
+func (m *FirewallSNATHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.FirewallSNAT{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+func (m *FirewallSNATHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	snat := instance.(*batchv1alpha1.FirewallSNAT)
+	src, err := getFirewallZoneName(r, snat, snat.Namespace, snat.Spec.Src)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := getFirewallZoneName(r, snat, snat.Namespace, snat.Spec.Dest)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPortRange("src_port", snat.Spec.SrcPort); err != nil {
+		return nil, err
+	}
+	if err := checkPortRange("src_dport", snat.Spec.SrcDPort); err != nil {
+		return nil, err
+	}
+	if err := checkPortRange("dest_port", snat.Spec.DestPort); err != nil {
+		return nil, err
+	}
+	return &openwrt.SdewanFirewallRedirect{
+		Name:     m.GetName(snat),
+		Src:      src,
+		SrcIp:    snat.Spec.SrcIp,
+		SrcDIp:   snat.Spec.SrcDIp,
+		SrcMac:   snat.Spec.SrcMac,
+		SrcPort:  snat.Spec.SrcPort,
+		SrcDPort: snat.Spec.SrcDPort,
+		Proto:    snat.Spec.Proto,
+		Dest:     dest,
+		DestIp:   snat.Spec.DestIp,
+		DestPort: snat.Spec.DestPort,
+		Mark:     snat.Spec.Mark,
+		Target:   "SNAT",
+	}, nil
+}
+
+func (m *FirewallSNATHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	snat1 := instance1.(*openwrt.SdewanFirewallRedirect)
+	snat2 := instance2.(*openwrt.SdewanFirewallRedirect)
+	return reflect.DeepEqual(*snat1, *snat2)
+}
+
+func (m *FirewallSNATHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	ret, err := firewall.GetRedirect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *FirewallSNATHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	snat := instance.(*openwrt.SdewanFirewallRedirect)
+	return firewall.CreateRedirect(ctx, *snat)
+}
+
+func (m *FirewallSNATHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	snat := instance.(*openwrt.SdewanFirewallRedirect)
+	return firewall.UpdateRedirect(ctx, *snat)
+}
+
+func (m *FirewallSNATHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	return firewall.DeleteRedirect(ctx, name)
+}
+
+func (m *FirewallSNATHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	objs, err := firewall.GetRedirects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Redirects))
+	for i, obj := range objs.Redirects {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+func (m *FirewallSNATHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return nil
+}
+
+func (m *FirewallSNATHandler) GetServiceName() string {
+	return "firewall"
+}
+
+func (m *FirewallSNATHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *FirewallSNATHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewallsnats,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewallsnats/status,verbs=get;update;patch
+
+func init() {
+	Register(&FirewallSNATHandler{}, &batchv1alpha1.FirewallSNAT{},
+		Watch{Object: &batchv1alpha1.FirewallZone{}, Mapper: firewallZoneToSNATs},
+	)
+}
+
+// Enqueue the SNATs which reference the changed FirewallZone in src or dest, so that
+// the openwrt zone name is resolved again when the zone is created or deleted
+func firewallZoneToSNATs(r client.Client, o handler.MapObject) []reconcile.Request {
+	snats := &batchv1alpha1.FirewallSNATList{}
+	err := r.List(context.Background(), snats, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		ctrl.Log.WithName("controllers").WithName("FirewallSNAT").Error(err, "Failed to list FirewallSNAT for zone", "zone", o.Meta.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, snat := range snats.Items {
+		if snat.Spec.Src == o.Meta.GetName() || snat.Spec.Dest == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: snat.Namespace, Name: snat.Name},
+			})
+		}
+	}
+	return requests
+}
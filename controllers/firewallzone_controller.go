@@ -0,0 +1,189 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+// openwrt zone names can't be longer than 11 characters
+const maxZoneNameLength = 11
+
+type FirewallZoneHandler struct {
+}
+
+func (m *FirewallZoneHandler) GetType() string {
+	return "FirewallZone"
+}
+
+func (m *FirewallZoneHandler) GetName(instance runtime.Object) string {
+	zone := instance.(*batchv1alpha1.FirewallZone)
+	return m.GetObjectPrefix() + zone.Name
+}
+
+// the CNF objects with the prefix are owned by the operator. The prefix is short,
+// as it counts in the length limit of openwrt zone names
+func (m *FirewallZoneHandler) GetObjectPrefix() string {
+	return "sdw_"
+}
+
+func (m *FirewallZoneHandler) GetFinalizer() string {
+	return "firewallzone.finalizers.sdewan.akraino.org"
+}
+
+func (m *FirewallZoneHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.FirewallZone{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+func (m *FirewallZoneHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	zone := instance.(*batchv1alpha1.FirewallZone)
+	name := m.GetName(zone)
+	if len(name) > maxZoneNameLength {
+		return nil, fmt.Errorf("FirewallZone name %s is longer than %d characters: openwrt zone %s would exceed the limit of %d",
+			zone.Name, maxZoneNameLength-len(m.GetObjectPrefix()), name, maxZoneNameLength)
+	}
+	networks := make([]string, len(zone.Spec.Network))
+	for i, network := range zone.Spec.Network {
+		iface, err := net2iface(network, deployment)
+		if err != nil {
+			return nil, err
+		}
+		networks[i] = iface
+	}
+	return &openwrt.SdewanFirewallZone{
+		Name:             name,
+		Network:          networks,
+		Masq:             zone.Spec.Masq,
+		MasqSrc:          zone.Spec.MasqSrc,
+		MasqDest:         zone.Spec.MasqDest,
+		MasqAllowInvalid: zone.Spec.MasqAllowInvalid,
+		MtuFix:           zone.Spec.MtuFix,
+		Input:            zone.Spec.Input,
+		Forward:          zone.Spec.Forward,
+		Output:           zone.Spec.Output,
+		Family:           zone.Spec.Family,
+		Subnet:           zone.Spec.Subnet,
+	}, nil
+}
+
+func (m *FirewallZoneHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	zone1 := instance1.(*openwrt.SdewanFirewallZone)
+	zone2 := instance2.(*openwrt.SdewanFirewallZone)
+	return reflect.DeepEqual(*zone1, *zone2)
+}
+
+func (m *FirewallZoneHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	ret, err := firewall.GetZone(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *FirewallZoneHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	zone := instance.(*openwrt.SdewanFirewallZone)
+	return firewall.CreateZone(ctx, *zone)
+}
+
+func (m *FirewallZoneHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	zone := instance.(*openwrt.SdewanFirewallZone)
+	return firewall.UpdateZone(ctx, *zone)
+}
+
+func (m *FirewallZoneHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	return firewall.DeleteZone(ctx, name)
+}
+
+func (m *FirewallZoneHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	firewall := openwrt.FirewallClient{OpenwrtClient: openwrtClient}
+	objs, err := firewall.GetZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Zones))
+	for i, obj := range objs.Zones {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+func (m *FirewallZoneHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return nil
+}
+
+func (m *FirewallZoneHandler) GetServiceName() string {
+	return "firewall"
+}
+
+func (m *FirewallZoneHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *FirewallZoneHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// resolve the FirewallZone CR referenced by other firewall CRs to the openwrt zone name.
+// An empty zone and the "*" wildcard are passed through as they are.
+func getFirewallZoneName(r client.Client, instance runtime.Object, namespace string, name string) (string, error) {
+	if name == "" || name == "*" {
+		return name, nil
+	}
+	zone := &batchv1alpha1.FirewallZone{}
+	err := r.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, zone)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get FirewallZone %s: %v", name, err)
+	}
+	if !zone.ObjectMeta.DeletionTimestamp.IsZero() {
+		return "", fmt.Errorf("FirewallZone %s is being deleted", name)
+	}
+	if getPurpose(zone) != getPurpose(instance) {
+		return "", fmt.Errorf("FirewallZone %s is not for cnf %s", name, getPurpose(instance))
+	}
+	zoneHandler := &FirewallZoneHandler{}
+	return zoneHandler.GetName(zone), nil
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewallzones,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=firewallzones/status,verbs=get;update;patch
+
+func init() {
+	Register(&FirewallZoneHandler{}, &batchv1alpha1.FirewallZone{})
+}
@@ -0,0 +1,103 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"sdewan.akraino.org/sdewan/basehandler"
+	"sdewan.akraino.org/sdewan/cnfprovider"
+)
+
+// garbageCollector periodically deletes the CNF objects of a kind which have no CR.
+// They are left on the CNF when a CR is deleted while the operator is down or while
+// no CNF exists. Only the objects with the prefix of the handler are deleted.
+type garbageCollector struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	log      logr.Logger
+	handler  basehandler.ISdewanHandler
+	object   runtime.Object
+	interval time.Duration
+}
+
+var _ manager.Runnable = &garbageCollector{}
+
+func (g *garbageCollector) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	// cancel the requests to the cnfs when the manager stops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		g.collect(ctx)
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *garbageCollector) collect(ctx context.Context) {
+	hasPurpose, err := labels.NewRequirement("sdewanPurpose", selection.Exists, nil)
+	if err != nil {
+		g.log.Error(err, "Failed to create label selector")
+		return
+	}
+	deployments := &extensionsv1beta1.DeploymentList{}
+	err = g.client.List(ctx, deployments, client.MatchingLabelsSelector{Selector: labels.NewSelector().Add(*hasPurpose)})
+	if err != nil {
+		g.log.Error(err, "Failed to list cnf deployments")
+		return
+	}
+	for _, deployment := range deployments.Items {
+		namespace := deployment.Namespace
+		purpose := deployment.Labels["sdewanPurpose"]
+		cnf, err := cnfprovider.NewOpenWrt(namespace, purpose, g.client)
+		if err != nil || cnf == nil || cnf.IsPaused() {
+			continue
+		}
+		getNames := func() ([]string, error) {
+			items, err := listCRs(g.client, g.scheme, g.object, namespace, purpose)
+			if err != nil {
+				return nil, err
+			}
+			names := make([]string, len(items))
+			for i, item := range items {
+				names[i] = g.handler.GetName(item)
+			}
+			return names, nil
+		}
+		_, _, err = cnf.DeleteOrphanObjects(ctx, g.handler, getNames)
+		if err != nil {
+			g.log.Error(err, "Failed to delete orphan objects", "cnf", deployment.Name)
+		}
+	}
+}
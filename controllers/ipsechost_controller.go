@@ -0,0 +1,232 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+// An IpsecHost is applied as an ipsec site with a single connection:
+// a responder accepts any peer ("%any") and hands out addresses from the
+// virtual IP pool (remote_sourceip), while an initiator connects to the hub
+// and requests its own address from the hub ("%config").
+type IpsecHostHandler struct {
+}
+
+func (m *IpsecHostHandler) GetType() string {
+	return "IpsecHost"
+}
+
+func (m *IpsecHostHandler) GetName(instance runtime.Object) string {
+	host := instance.(*batchv1alpha1.IpsecHost)
+	return m.GetObjectPrefix() + host.Name
+}
+
+// the CNF objects with the prefix are owned by the operator
+func (m *IpsecHostHandler) GetObjectPrefix() string {
+	return "sdwih_"
+}
+
+func (m *IpsecHostHandler) GetFinalizer() string {
+	return "ipsechost.finalizers.sdewan.akraino.org"
+}
+
+func (m *IpsecHostHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.IpsecHost{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+func (m *IpsecHostHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	host := instance.(*batchv1alpha1.IpsecHost)
+	connection := openwrt.SdewanIpsecConnection{
+		Name:         host.Name,
+		Type:         "tunnel",
+		LocalSubnet:  host.Spec.LocalSubnet,
+		RemoteSubnet: host.Spec.RemoteSubnet,
+	}
+	gateway := ""
+	switch host.Spec.Role {
+	case "responder":
+		if host.Spec.VirtualIpPool == "" {
+			return nil, errors.New("virtual_ip_pool is required by responder")
+		}
+		gateway = "%any"
+		connection.Mode = "add"
+		connection.RemoteSourceip = host.Spec.VirtualIpPool
+	case "initiator":
+		if host.Spec.Remote == "" {
+			return nil, errors.New("remote is required by initiator")
+		}
+		gateway = host.Spec.Remote
+		connection.Mode = "start"
+		connection.LocalSourceip = "%config"
+	default:
+		return nil, errors.New("Unknown role: " + host.Spec.Role)
+	}
+
+	psk, err := getSecretValue(r, host.Namespace, host.Spec.PreSharedKey)
+	if err != nil {
+		return nil, err
+	}
+	publicCert, err := getSecretValue(r, host.Namespace, host.Spec.LocalPublicCert)
+	if err != nil {
+		return nil, err
+	}
+	privateCert, err := getSecretValue(r, host.Namespace, host.Spec.LocalPrivateCert)
+	if err != nil {
+		return nil, err
+	}
+	sharedCa, err := getSecretValue(r, host.Namespace, host.Spec.SharedCa)
+	if err != nil {
+		return nil, err
+	}
+	proposals, err := getIpsecProposalNames(r, host, host.Namespace, host.Spec.CryptoProposal)
+	if err != nil {
+		return nil, err
+	}
+	connection.CryptoProposal = proposals
+	return &openwrt.SdewanIpsecSite{
+		Name:                 m.GetName(host),
+		Gateway:              gateway,
+		PreSharedKey:         psk,
+		AuthenticationMethod: host.Spec.AuthenticationMethod,
+		LocalIdentifier:      host.Spec.LocalIdentifier,
+		RemoteIdentifier:     host.Spec.RemoteIdentifier,
+		CryptoProposal:       proposals,
+		ForceCryptoProposal:  host.Spec.ForceCryptoProposal,
+		LocalPublicCert:      publicCert,
+		LocalPrivateCert:     privateCert,
+		SharedCa:             sharedCa,
+		Connections:          []openwrt.SdewanIpsecConnection{connection},
+	}, nil
+}
+
+func (m *IpsecHostHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	host1 := instance1.(*openwrt.SdewanIpsecSite)
+	host2 := instance2.(*openwrt.SdewanIpsecSite)
+	return reflect.DeepEqual(*host1, *host2)
+}
+
+func (m *IpsecHostHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	ret, err := ipsec.GetSite(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *IpsecHostHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	host := instance.(*openwrt.SdewanIpsecSite)
+	return ipsec.CreateSite(ctx, *host)
+}
+
+func (m *IpsecHostHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	host := instance.(*openwrt.SdewanIpsecSite)
+	return ipsec.UpdateSite(ctx, *host)
+}
+
+func (m *IpsecHostHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	return ipsec.DeleteSite(ctx, name)
+}
+
+func (m *IpsecHostHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	objs, err := ipsec.GetSites(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Sites))
+	for i, obj := range objs.Sites {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+// a host is healthy when its connection is up in the IKE daemon
+func (m *IpsecHostHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return checkIpsecConnection(ctx, clientInfo, instance.(*openwrt.SdewanIpsecSite))
+}
+
+func (m *IpsecHostHandler) GetServiceName() string {
+	return "ipsec"
+}
+
+func (m *IpsecHostHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *IpsecHostHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=ipsechosts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=ipsechosts/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+func init() {
+	Register(&IpsecHostHandler{}, &batchv1alpha1.IpsecHost{},
+		Watch{Object: &corev1.Secret{}, Mapper: secretToIpsecHosts},
+	)
+}
+
+// Enqueue the hosts which reference the changed secret, so that rotated
+// credentials are pushed to the CNF
+func secretToIpsecHosts(r client.Client, o handler.MapObject) []reconcile.Request {
+	hosts := &batchv1alpha1.IpsecHostList{}
+	err := r.List(context.Background(), hosts, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		ctrl.Log.WithName("controllers").WithName("IpsecHost").Error(err, "Failed to list IpsecHost for secret", "secret", o.Meta.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, host := range hosts.Items {
+		for _, selector := range []*corev1.SecretKeySelector{host.Spec.PreSharedKey, host.Spec.LocalPublicCert, host.Spec.LocalPrivateCert, host.Spec.SharedCa} {
+			if selector != nil && selector.Name == o.Meta.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: host.Namespace, Name: host.Name},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
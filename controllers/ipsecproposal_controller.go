@@ -0,0 +1,167 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+type IpsecProposalHandler struct {
+}
+
+func (m *IpsecProposalHandler) GetType() string {
+	return "IpsecProposal"
+}
+
+func (m *IpsecProposalHandler) GetName(instance runtime.Object) string {
+	proposal := instance.(*batchv1alpha1.IpsecProposal)
+	return m.GetObjectPrefix() + proposal.Name
+}
+
+// the CNF objects with the prefix are owned by the operator
+func (m *IpsecProposalHandler) GetObjectPrefix() string {
+	return "sdwip_"
+}
+
+func (m *IpsecProposalHandler) GetFinalizer() string {
+	return "ipsecproposal.finalizers.sdewan.akraino.org"
+}
+
+func (m *IpsecProposalHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.IpsecProposal{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+func (m *IpsecProposalHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	proposal := instance.(*batchv1alpha1.IpsecProposal)
+	return &openwrt.SdewanIpsecProposal{
+		Name:                m.GetName(proposal),
+		EncryptionAlgorithm: proposal.Spec.EncryptionAlgorithm,
+		HashAlgorithm:       proposal.Spec.HashAlgorithm,
+		DhGroup:             proposal.Spec.DhGroup,
+	}, nil
+}
+
+func (m *IpsecProposalHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	proposal1 := instance1.(*openwrt.SdewanIpsecProposal)
+	proposal2 := instance2.(*openwrt.SdewanIpsecProposal)
+	return reflect.DeepEqual(*proposal1, *proposal2)
+}
+
+func (m *IpsecProposalHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	ret, err := ipsec.GetProposal(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *IpsecProposalHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	proposal := instance.(*openwrt.SdewanIpsecProposal)
+	return ipsec.CreateProposal(ctx, *proposal)
+}
+
+func (m *IpsecProposalHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	proposal := instance.(*openwrt.SdewanIpsecProposal)
+	return ipsec.UpdateProposal(ctx, *proposal)
+}
+
+func (m *IpsecProposalHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	return ipsec.DeleteProposal(ctx, name)
+}
+
+func (m *IpsecProposalHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	objs, err := ipsec.GetProposals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Proposals))
+	for i, obj := range objs.Proposals {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+func (m *IpsecProposalHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return nil
+}
+
+func (m *IpsecProposalHandler) GetServiceName() string {
+	return "ipsec"
+}
+
+func (m *IpsecProposalHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *IpsecProposalHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// resolve the IpsecProposal CRs referenced by ipsec CRs to the openwrt proposal names
+func getIpsecProposalNames(r client.Client, instance runtime.Object, namespace string, names []string) ([]string, error) {
+	if names == nil {
+		return nil, nil
+	}
+	proposalHandler := &IpsecProposalHandler{}
+	proposalNames := make([]string, len(names))
+	for i, name := range names {
+		proposal := &batchv1alpha1.IpsecProposal{}
+		err := r.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, proposal)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get IpsecProposal %s: %v", name, err)
+		}
+		if !proposal.ObjectMeta.DeletionTimestamp.IsZero() {
+			return nil, fmt.Errorf("IpsecProposal %s is being deleted", name)
+		}
+		if getPurpose(proposal) != getPurpose(instance) {
+			return nil, fmt.Errorf("IpsecProposal %s is not for cnf %s", name, getPurpose(instance))
+		}
+		proposalNames[i] = proposalHandler.GetName(proposal)
+	}
+	return proposalNames, nil
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=ipsecproposals,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=ipsecproposals/status,verbs=get;update;patch
+
+func init() {
+	Register(&IpsecProposalHandler{}, &batchv1alpha1.IpsecProposal{})
+}
@@ -0,0 +1,275 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+)
+
+type IpsecSiteHandler struct {
+}
+
+func (m *IpsecSiteHandler) GetType() string {
+	return "IpsecSite"
+}
+
+func (m *IpsecSiteHandler) GetName(instance runtime.Object) string {
+	site := instance.(*batchv1alpha1.IpsecSite)
+	return m.GetObjectPrefix() + site.Name
+}
+
+// the CNF objects with the prefix are owned by the operator
+func (m *IpsecSiteHandler) GetObjectPrefix() string {
+	return "sdwis_"
+}
+
+func (m *IpsecSiteHandler) GetFinalizer() string {
+	return "ipsecsite.finalizers.sdewan.akraino.org"
+}
+
+func (m *IpsecSiteHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.IpsecSite{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+// convert the connections of ipsec CRs to openwrt connections
+func convertIpsecConnections(r client.Client, instance runtime.Object, namespace string, connections []batchv1alpha1.IpsecConnection) ([]openwrt.SdewanIpsecConnection, error) {
+	if connections == nil {
+		return nil, nil
+	}
+	ret := make([]openwrt.SdewanIpsecConnection, len(connections))
+	for i, conn := range connections {
+		proposals, err := getIpsecProposalNames(r, instance, namespace, conn.CryptoProposal)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = openwrt.SdewanIpsecConnection{
+			Name:           conn.Name,
+			Type:           conn.Type,
+			Mode:           conn.Mode,
+			LocalSubnet:    conn.LocalSubnet,
+			LocalNat:       conn.LocalNat,
+			LocalSourceip:  conn.LocalSourceip,
+			LocalUpdown:    conn.LocalUpdown,
+			LocalFirewall:  conn.LocalFirewall,
+			RemoteSubnet:   conn.RemoteSubnet,
+			RemoteSourceip: conn.RemoteSourceip,
+			RemoteUpdown:   conn.RemoteUpdown,
+			RemoteFirewall: conn.RemoteFirewall,
+			CryptoProposal: proposals,
+		}
+	}
+	return ret, nil
+}
+
+// checkIpsecConnection checks the connection of a site in the IKE daemon. When the site
+// initiates the SAs (a connection of mode start), the IKE SA must be established with an
+// installed child SA. Otherwise the SAs are set up by the peer, the connection only has to be loaded.
+func checkIpsecConnection(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, site *openwrt.SdewanIpsecSite) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	status, err := ipsec.GetConnectionStatus(ctx)
+	if err != nil {
+		if openwrt.IsNotFound(err) {
+			// the CNF doesn't provide the status API, the connection can't be checked
+			return nil
+		}
+		return err
+	}
+	initiator := false
+	for _, conn := range site.Connections {
+		if conn.Mode == "start" {
+			initiator = true
+		}
+	}
+	for _, conn := range status.Connections {
+		if conn.Name != site.Name {
+			continue
+		}
+		if !initiator {
+			return nil
+		}
+		if conn.State != openwrt.IpsecSaStateEstablished {
+			return fmt.Errorf("IKE SA of IPsec connection %s is not established: %q", site.Name, conn.State)
+		}
+		for _, child := range conn.Children {
+			if child.State == openwrt.IpsecSaStateInstalled {
+				return nil
+			}
+		}
+		return fmt.Errorf("IPsec connection %s has no installed child SA", site.Name)
+	}
+	return fmt.Errorf("IPsec connection %s is not loaded", site.Name)
+}
+
+func (m *IpsecSiteHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	site := instance.(*batchv1alpha1.IpsecSite)
+	psk, err := getSecretValue(r, site.Namespace, site.Spec.PreSharedKey)
+	if err != nil {
+		return nil, err
+	}
+	publicCert, err := getSecretValue(r, site.Namespace, site.Spec.LocalPublicCert)
+	if err != nil {
+		return nil, err
+	}
+	privateCert, err := getSecretValue(r, site.Namespace, site.Spec.LocalPrivateCert)
+	if err != nil {
+		return nil, err
+	}
+	sharedCa, err := getSecretValue(r, site.Namespace, site.Spec.SharedCa)
+	if err != nil {
+		return nil, err
+	}
+	proposals, err := getIpsecProposalNames(r, site, site.Namespace, site.Spec.CryptoProposal)
+	if err != nil {
+		return nil, err
+	}
+	connections, err := convertIpsecConnections(r, site, site.Namespace, site.Spec.Connections)
+	if err != nil {
+		return nil, err
+	}
+	return &openwrt.SdewanIpsecSite{
+		Name:                 m.GetName(site),
+		Gateway:              site.Spec.Gateway,
+		PreSharedKey:         psk,
+		AuthenticationMethod: site.Spec.AuthenticationMethod,
+		LocalIdentifier:      site.Spec.LocalIdentifier,
+		RemoteIdentifier:     site.Spec.RemoteIdentifier,
+		CryptoProposal:       proposals,
+		ForceCryptoProposal:  site.Spec.ForceCryptoProposal,
+		LocalPublicCert:      publicCert,
+		LocalPrivateCert:     privateCert,
+		SharedCa:             sharedCa,
+		Connections:          connections,
+	}, nil
+}
+
+func (m *IpsecSiteHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	site1 := instance1.(*openwrt.SdewanIpsecSite)
+	site2 := instance2.(*openwrt.SdewanIpsecSite)
+	return reflect.DeepEqual(*site1, *site2)
+}
+
+func (m *IpsecSiteHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	ret, err := ipsec.GetSite(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *IpsecSiteHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	site := instance.(*openwrt.SdewanIpsecSite)
+	return ipsec.CreateSite(ctx, *site)
+}
+
+func (m *IpsecSiteHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	site := instance.(*openwrt.SdewanIpsecSite)
+	return ipsec.UpdateSite(ctx, *site)
+}
+
+func (m *IpsecSiteHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	return ipsec.DeleteSite(ctx, name)
+}
+
+func (m *IpsecSiteHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	ipsec := openwrt.IpsecClient{OpenwrtClient: openwrtClient}
+	objs, err := ipsec.GetSites(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Sites))
+	for i, obj := range objs.Sites {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+// a site is healthy when its connection is up in the IKE daemon
+func (m *IpsecSiteHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	return checkIpsecConnection(ctx, clientInfo, instance.(*openwrt.SdewanIpsecSite))
+}
+
+func (m *IpsecSiteHandler) GetServiceName() string {
+	return "ipsec"
+}
+
+func (m *IpsecSiteHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *IpsecSiteHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=ipsecsites,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=ipsecsites/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+func init() {
+	Register(&IpsecSiteHandler{}, &batchv1alpha1.IpsecSite{},
+		Watch{Object: &corev1.Secret{}, Mapper: secretToIpsecSites},
+	)
+}
+
+// Enqueue the sites which reference the changed secret, so that rotated
+// credentials are pushed to the CNF
+func secretToIpsecSites(r client.Client, o handler.MapObject) []reconcile.Request {
+	sites := &batchv1alpha1.IpsecSiteList{}
+	err := r.List(context.Background(), sites, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		ctrl.Log.WithName("controllers").WithName("IpsecSite").Error(err, "Failed to list IpsecSite for secret", "secret", o.Meta.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, site := range sites.Items {
+		for _, selector := range []*corev1.SecretKeySelector{site.Spec.PreSharedKey, site.Spec.LocalPublicCert, site.Spec.LocalPrivateCert, site.Spec.SharedCa} {
+			if selector != nil && selector.Name == o.Meta.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: site.Namespace, Name: site.Name},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
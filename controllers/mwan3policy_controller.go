@@ -17,11 +17,8 @@ package controllers
 
 import (
 	"context"
-	"time"
+	"fmt"
 
-	"github.com/go-logr/logr"
-	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -29,9 +26,9 @@ import (
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
 	"reflect"
 	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
-	"sdewan.akraino.org/sdewan/cnfprovider"
 	"sdewan.akraino.org/sdewan/openwrt"
 	"strconv"
+	"strings"
 )
 
 type Mwan3PolicyHandler struct {
@@ -43,20 +40,25 @@ func (m *Mwan3PolicyHandler) GetType() string {
 
 func (m *Mwan3PolicyHandler) GetName(instance runtime.Object) string {
 	policy := instance.(*batchv1alpha1.Mwan3Policy)
-	return policy.Name
+	return m.GetObjectPrefix() + policy.Name
 }
 
-func (m *Mwan3PolicyHandler) GetFinalizer() (string) {
+// the CNF objects with the prefix are owned by the operator
+func (m *Mwan3PolicyHandler) GetObjectPrefix() string {
+	return "sdwmp_"
+}
+
+func (m *Mwan3PolicyHandler) GetFinalizer() string {
 	return "rule.finalizers.sdewan.akraino.org"
 }
 
-func (m *Mwan3PolicyHandler) GetInstance(r client.Client, ctx Context, req ctrl.Request) (runtime.Object, error) {
+func (m *Mwan3PolicyHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
 	instance := &batchv1alpha1.Mwan3Policy{}
 	err := r.Get(ctx, req.NamespacedName, instance)
 	return instance, err
 }
 
-func (m *Mwan3PolicyHandler) Convert(instance runtime.Object, deployment extensionsv1beta1.Deployment) (IOpenWrtObject, error) {
+func (m *Mwan3PolicyHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
 	policy := instance.(*batchv1alpha1.Mwan3Policy)
 	members := make([]openwrt.SdewanMember, len(policy.Spec.Members))
 	for i, membercr := range policy.Spec.Members {
@@ -70,167 +72,104 @@ func (m *Mwan3PolicyHandler) Convert(instance runtime.Object, deployment extensi
 			Weight:    strconv.Itoa(membercr.Weight),
 		}
 	}
-	return &openwrt.SdewanPolicy{Name: policy.Name, Members: members}, nil
+	return &openwrt.SdewanPolicy{Name: m.GetName(policy), Members: members}, nil
 }
 
-func (m *Mwan3PolicyHandler) IsEqual(instance1 IOpenWrtObject, instance2 IOpenWrtObject) (bool) {
+func (m *Mwan3PolicyHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
 	policy1 := instance1.(*openwrt.SdewanPolicy)
 	policy2 := instance2.(*openwrt.SdewanPolicy)
-	reflect.DeepEqual(*policy1, *policy2)
+	return reflect.DeepEqual(*policy1, *policy2)
+}
+
+// the policies were named after the CR before the prefix was introduced
+func (m *Mwan3PolicyHandler) IsLegacyObject(legacy openwrt.IOpenWrtObject, instance openwrt.IOpenWrtObject) bool {
+	policy := *instance.(*openwrt.SdewanPolicy)
+	policy.Name = strings.TrimPrefix(policy.Name, m.GetObjectPrefix())
+	return reflect.DeepEqual(*legacy.(*openwrt.SdewanPolicy), policy)
 }
 
-func (m *Mwan3PolicyHandler) GetObject(clientInfo *openwrt.OpenwrtClientInfo, name string) (IOpenWrtObject, error) {
+func (m *Mwan3PolicyHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
 	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
 	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
-	return mwan3.GetPolicy(policy.Name)
+	ret, err := mwan3.GetPolicy(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
 }
 
-func (m *Mwan3PolicyHandler) CreateObject(clientInfo *OpenwrtClientInfo, instance IOpenWrtObject) (IOpenWrtObject, error) {
+func (m *Mwan3PolicyHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
 	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
 	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
 	policy := instance.(*openwrt.SdewanPolicy)
-	return mwan3.CreatePolicy(*policy)
+	return mwan3.CreatePolicy(ctx, *policy)
 }
 
-func (m *Mwan3PolicyHandler) UpdateObject(clientInfo *OpenwrtClientInfo, instance IOpenWrtObject) (IOpenWrtObject, error) {
+func (m *Mwan3PolicyHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
 	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
 	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
 	policy := instance.(*openwrt.SdewanPolicy)
-	return mwan3.UpdatePolicy(*policy)
+	return mwan3.UpdatePolicy(ctx, *policy)
 }
 
-func (m *Mwan3PolicyHandler) DeleteObject(clientInfo *openwrt.OpenwrtClientInfo, name string) (error) {
+func (m *Mwan3PolicyHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
 	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
 	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
-	return mwan3.DeletePolicy(name)
+	return mwan3.DeletePolicy(ctx, name)
 }
 
-func (m *Mwan3PolicyHandler) Restart(clientInfo *OpenwrtClientInfo) (bool, error) {
+func (m *Mwan3PolicyHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
 	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
-	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
-	return service.ExecuteService("mwan3", "restart")
-}
-
-// Mwan3PolicyReconciler reconciles a Mwan3Policy object
-type Mwan3PolicyReconciler struct {
-	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
+	objs, err := mwan3.GetPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Policies))
+	for i, obj := range objs.Policies {
+		names[i] = obj.Name
+	}
+	return names, nil
 }
 
-// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=mwan3policies,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=mwan3policies/status,verbs=get;update;patch
-func (r *Mwan3PolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	return ProcessReconcile(r, r.Log, req, &mwan3policyHandler{})
+// a policy is healthy when one of its member interfaces is online
+func (m *Mwan3PolicyHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
+	return checkPolicyMembers(ctx, &mwan3, instance.(*openwrt.SdewanPolicy))
 }
 
-/*
-func (r *Mwan3PolicyReconciler) OldReconcile (req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
-	log := r.Log.WithValues("mwan3policy", req.NamespacedName)
-
-	// your logic here
-	during, _ := time.ParseDuration("5s")
-	instance := &batchv1alpha1.Mwan3Policy{}
-	err := r.Get(ctx, req.NamespacedName, instance)
+// a policy is usable when one of its member interfaces is online
+func checkPolicyMembers(ctx context.Context, mwan3 *openwrt.Mwan3Client, policy *openwrt.SdewanPolicy) error {
+	status, err := mwan3.GetInterfaceStatus(ctx)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			// No instance
-			return ctrl.Result{}, nil
-		}
-		// Error reading the object - requeue the request.
-		return ctrl.Result{RequeueAfter: during}, nil
+		return err
 	}
-	cnf, err := cnfprovider.NewWrt(req.NamespacedName.Namespace, instance.Labels["sdewanPurpose"], r.Client)
-	if err != nil {
-		log.Error(err, "Failed to get cnf")
-		// A new event are supposed to be received upon cnf ready
-		// so not requeue
-		return ctrl.Result{}, nil
-	}
-	finalizerName := "rule.finalizers.sdewan.akraino.org"
-	if instance.ObjectMeta.DeletionTimestamp.IsZero() {
-		// creating or updating CR
-		if cnf == nil {
-			// no cnf exists
-			log.Info("No cnf exist, so not create/update mwan3 policy")
-			return ctrl.Result{}, nil
-		}
-		changed, err := cnf.AddUpdateMwan3Policy(instance)
-		if err != nil {
-			log.Error(err, "Failed to add/update mwan3 policy")
-			return ctrl.Result{RequeueAfter: during}, nil
-		}
-		if !containsString(instance.ObjectMeta.Finalizers, finalizerName) {
-			log.Info("Adding finalizer for mwan3 policy")
-			instance.ObjectMeta.Finalizers = append(instance.ObjectMeta.Finalizers, finalizerName)
-			if err := r.Update(ctx, instance); err != nil {
-				return ctrl.Result{}, err
-			}
-		}
-		if changed {
-			instance.Status.AppliedVersion = instance.ResourceVersion
-			instance.Status.AppliedTime = &metav1.Time{Time: time.Now()}
-			instance.Status.InSync = true
-			err = r.Status().Update(ctx, instance)
-			if err != nil {
-				log.Error(err, "Failed to update mwan3 policy status")
-				return ctrl.Result{}, err
-			}
-		}
-	} else {
-		// deletin CR
-		if cnf == nil {
-			// no cnf exists
-			if containsString(instance.ObjectMeta.Finalizers, finalizerName) {
-				instance.ObjectMeta.Finalizers = removeString(instance.ObjectMeta.Finalizers, finalizerName)
-				if err := r.Update(ctx, instance); err != nil {
-					return ctrl.Result{}, err
-				}
-			}
-			return ctrl.Result{}, nil
-		}
-		_, err := cnf.DeleteMwan3Policy(instance)
-		if err != nil {
-			log.Error(err, "Failed to delete mwan3 policy")
-			return ctrl.Result{RequeueAfter: during}, nil
-		}
-		if containsString(instance.ObjectMeta.Finalizers, finalizerName) {
-			instance.ObjectMeta.Finalizers = removeString(instance.ObjectMeta.Finalizers, finalizerName)
-			if err := r.Update(ctx, instance); err != nil {
-				return ctrl.Result{}, err
-			}
+	for _, member := range policy.Members {
+		if iface, ok := status.Interfaces[member.Interface]; ok && iface.Status == "online" {
+			return nil
 		}
 	}
+	return fmt.Errorf("No member interface of policy %s is online", policy.Name)
+}
 
-	return ctrl.Result{}, nil
+func (m *Mwan3PolicyHandler) GetServiceName() string {
+	return "mwan3"
 }
-*/
 
-func (r *Mwan3PolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&batchv1alpha1.Mwan3Policy{}).
-		Complete(r)
+func (m *Mwan3PolicyHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
 }
 
-/*
-// Helper functions to check and remove string from a slice of strings.
-func containsString(slice []string, s string) bool {
-	for _, item := range slice {
-		if item == s {
-			return true
-		}
-	}
-	return false
+func (m *Mwan3PolicyHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
 }
 
-func removeString(slice []string, s string) (result []string) {
-	for _, item := range slice {
-		if item == s {
-			continue
-		}
-		result = append(result, item)
-	}
-	return
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=mwan3policies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=mwan3policies/status,verbs=get;update;patch
+
+func init() {
+	Register(&Mwan3PolicyHandler{}, &batchv1alpha1.Mwan3Policy{})
 }
-*/
@@ -0,0 +1,208 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"reflect"
+	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/openwrt"
+	"strings"
+)
+
+type Mwan3RuleHandler struct {
+}
+
+func (m *Mwan3RuleHandler) GetType() string {
+	return "Mwan3Rule"
+}
+
+func (m *Mwan3RuleHandler) GetName(instance runtime.Object) string {
+	rule := instance.(*batchv1alpha1.Mwan3Rule)
+	return m.GetObjectPrefix() + rule.Name
+}
+
+// the CNF objects with the prefix are owned by the operator
+func (m *Mwan3RuleHandler) GetObjectPrefix() string {
+	return "sdwmr_"
+}
+
+func (m *Mwan3RuleHandler) GetFinalizer() string {
+	return "mwan3rule.finalizers.sdewan.akraino.org"
+}
+
+func (m *Mwan3RuleHandler) GetInstance(r client.Client, ctx context.Context, req ctrl.Request) (runtime.Object, error) {
+	instance := &batchv1alpha1.Mwan3Rule{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	return instance, err
+}
+
+// resolve the Mwan3Policy CR referenced by the rule to the openwrt policy name
+func (m *Mwan3RuleHandler) getPolicyName(r client.Client, rule *batchv1alpha1.Mwan3Rule) (string, error) {
+	policy := &batchv1alpha1.Mwan3Policy{}
+	err := r.Get(context.Background(), types.NamespacedName{Namespace: rule.Namespace, Name: rule.Spec.Policy}, policy)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get Mwan3Policy %s: %v", rule.Spec.Policy, err)
+	}
+	if getPurpose(policy) != getPurpose(rule) {
+		return "", fmt.Errorf("Mwan3Policy %s is not for cnf %s", rule.Spec.Policy, getPurpose(rule))
+	}
+	policyHandler := &Mwan3PolicyHandler{}
+	return policyHandler.GetName(policy), nil
+}
+
+func (m *Mwan3RuleHandler) Convert(r client.Client, instance runtime.Object, deployment extensionsv1beta1.Deployment) (openwrt.IOpenWrtObject, error) {
+	rule := instance.(*batchv1alpha1.Mwan3Rule)
+	policy, err := m.getPolicyName(r, rule)
+	if err != nil {
+		return nil, err
+	}
+	return &openwrt.SdewanRule{
+		Name:     m.GetName(rule),
+		Policy:   policy,
+		SrcIp:    rule.Spec.SrcIp,
+		SrcPort:  rule.Spec.SrcPort,
+		DestIp:   rule.Spec.DestIp,
+		DestPort: rule.Spec.DestPort,
+		Proto:    rule.Spec.Proto,
+		Family:   rule.Spec.Family,
+		Sticky:   rule.Spec.Sticky,
+		Timeout:  rule.Spec.Timeout,
+	}, nil
+}
+
+func (m *Mwan3RuleHandler) IsEqual(instance1 openwrt.IOpenWrtObject, instance2 openwrt.IOpenWrtObject) bool {
+	rule1 := instance1.(*openwrt.SdewanRule)
+	rule2 := instance2.(*openwrt.SdewanRule)
+	return reflect.DeepEqual(*rule1, *rule2)
+}
+
+// the rules and their policies were named after the CRs before the prefix was introduced
+func (m *Mwan3RuleHandler) IsLegacyObject(legacy openwrt.IOpenWrtObject, instance openwrt.IOpenWrtObject) bool {
+	rule := *instance.(*openwrt.SdewanRule)
+	rule.Name = strings.TrimPrefix(rule.Name, m.GetObjectPrefix())
+	rule.Policy = strings.TrimPrefix(rule.Policy, (&Mwan3PolicyHandler{}).GetObjectPrefix())
+	return reflect.DeepEqual(*legacy.(*openwrt.SdewanRule), rule)
+}
+
+func (m *Mwan3RuleHandler) GetObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
+	ret, err := mwan3.GetRule(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *Mwan3RuleHandler) CreateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
+	rule := instance.(*openwrt.SdewanRule)
+	return mwan3.CreateRule(ctx, *rule)
+}
+
+func (m *Mwan3RuleHandler) UpdateObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) (openwrt.IOpenWrtObject, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
+	rule := instance.(*openwrt.SdewanRule)
+	return mwan3.UpdateRule(ctx, *rule)
+}
+
+func (m *Mwan3RuleHandler) DeleteObject(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, name string) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
+	return mwan3.DeleteRule(ctx, name)
+}
+
+func (m *Mwan3RuleHandler) ListObjectNames(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo) ([]string, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
+	objs, err := mwan3.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs.Rules))
+	for i, obj := range objs.Rules {
+		names[i] = obj.Name
+	}
+	return names, nil
+}
+
+// a rule is healthy when a member interface of the policy it references is online
+func (m *Mwan3RuleHandler) CheckHealth(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, instance openwrt.IOpenWrtObject) error {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	mwan3 := openwrt.Mwan3Client{OpenwrtClient: openwrtClient}
+	rule := instance.(*openwrt.SdewanRule)
+	policy, err := mwan3.GetPolicy(ctx, rule.Policy)
+	if err != nil {
+		return fmt.Errorf("Failed to get policy %s of rule %s: %w", rule.Policy, rule.Name, err)
+	}
+	return checkPolicyMembers(ctx, &mwan3, policy)
+}
+
+func (m *Mwan3RuleHandler) GetServiceName() string {
+	return "mwan3"
+}
+
+func (m *Mwan3RuleHandler) GetServiceActions() []string {
+	return []string{openwrt.ServiceActionReload, openwrt.ServiceActionRestart}
+}
+
+func (m *Mwan3RuleHandler) ExecuteService(ctx context.Context, clientInfo *openwrt.OpenwrtClientInfo, action string) (bool, error) {
+	openwrtClient := openwrt.GetOpenwrtClient(*clientInfo)
+	service := openwrt.ServiceClient{OpenwrtClient: openwrtClient}
+	return service.ExecuteService(ctx, m.GetServiceName(), action)
+}
+
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=mwan3rules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch.sdewan.akraino.org,resources=mwan3rules/status,verbs=get;update;patch
+
+func init() {
+	Register(&Mwan3RuleHandler{}, &batchv1alpha1.Mwan3Rule{},
+		Watch{Object: &batchv1alpha1.Mwan3Policy{}, Mapper: mwan3PolicyToRules},
+	)
+}
+
+// Enqueue the rules which reference the changed Mwan3Policy, so that a rule is
+// applied as soon as its policy is created, and fails once the policy is deleted
+func mwan3PolicyToRules(r client.Client, o handler.MapObject) []reconcile.Request {
+	rules := &batchv1alpha1.Mwan3RuleList{}
+	err := r.List(context.Background(), rules, client.InNamespace(o.Meta.GetNamespace()))
+	if err != nil {
+		ctrl.Log.WithName("controllers").WithName("Mwan3Rule").Error(err, "Failed to list Mwan3Rule for policy", "policy", o.Meta.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, rule := range rules.Items {
+		if rule.Spec.Policy == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: rule.Namespace, Name: rule.Name},
+			})
+		}
+	}
+	return requests
+}
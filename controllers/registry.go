@@ -0,0 +1,221 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"sdewan.akraino.org/sdewan/basehandler"
+)
+
+// WatchMapper maps a changed object, which is watched in addition to the CR,
+// to the CRs to be reconciled
+type WatchMapper func(r client.Client, o handler.MapObject) []reconcile.Request
+
+// Watch is an additional object type watched by the controller of a kind
+type Watch struct {
+	Object runtime.Object
+	Mapper WatchMapper
+}
+
+type registeredKind struct {
+	handler basehandler.ISdewanHandler
+	object  runtime.Object
+	watches []Watch
+}
+
+// registered kinds in the order of registration
+var registry []registeredKind
+
+// Register adds the handler of a CR kind to the registry. object is the CR type
+// watched by the controller of the kind. Handlers register themselves in init().
+func Register(handler basehandler.ISdewanHandler, object runtime.Object, watches ...Watch) {
+	if getRegisteredKind(handler.GetType()) != nil {
+		panic("Duplicate registration of kind " + handler.GetType())
+	}
+	registry = append(registry, registeredKind{handler, object, watches})
+}
+
+func getRegisteredKind(kind string) *registeredKind {
+	for i := range registry {
+		if registry[i].handler.GetType() == kind {
+			return &registry[i]
+		}
+	}
+	return nil
+}
+
+// RegisteredKinds returns all the registered kinds
+func RegisteredKinds() []string {
+	kinds := make([]string, len(registry))
+	for i, item := range registry {
+		kinds[i] = item.handler.GetType()
+	}
+	return kinds
+}
+
+// EnabledKinds parses a comma-separated list of kinds. "*" enables all the
+// registered kinds, "Kind" enables a kind and "-Kind" disables it.
+func EnabledKinds(spec string) ([]string, error) {
+	enabled := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+		case item == "*":
+			for _, kind := range RegisteredKinds() {
+				if _, ok := enabled[kind]; !ok {
+					enabled[kind] = true
+				}
+			}
+		case strings.HasPrefix(item, "-"):
+			if getRegisteredKind(item[1:]) == nil {
+				return nil, fmt.Errorf("Unknown controller: %s", item[1:])
+			}
+			enabled[item[1:]] = false
+		default:
+			if getRegisteredKind(item) == nil {
+				return nil, fmt.Errorf("Unknown controller: %s", item)
+			}
+			enabled[item] = true
+		}
+	}
+	var kinds []string
+	for _, kind := range RegisteredKinds() {
+		if enabled[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds, nil
+}
+
+// Options are the settings shared by the controllers of all the kinds
+type Options struct {
+	// ResyncInterval is the interval to check the applied CRs against the
+	// runtime config of the CNF and repair the drift. 0 disables the resync.
+	ResyncInterval time.Duration
+	// GcInterval is the interval to delete the CNF objects which have no CR. 0 disables the gc.
+	GcInterval time.Duration
+	// MaxConcurrentReconciles is the number of CRs of a kind reconciled at the same time.
+	// The changes of concurrent reconciles share the service restarts of the CNF.
+	MaxConcurrentReconciles int
+	// DryRun only computes the changes to the CNFs into the CR status and Events, without applying them
+	DryRun bool
+}
+
+// SdewanReconciler reconciles the CRs of one registered kind
+type SdewanReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Handler  basehandler.ISdewanHandler
+	Options  Options
+	// the CRs to reconcile again, e.g. after a failed service action they didn't wait for
+	requeue chan event.GenericEvent
+}
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+func (r *SdewanReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	return ProcessReconcile(r, req)
+}
+
+// SetupControllerWithManager creates the controller of a registered kind
+func SetupControllerWithManager(mgr ctrl.Manager, kind string, options Options) error {
+	item := getRegisteredKind(kind)
+	if item == nil {
+		return fmt.Errorf("Unknown controller: %s", kind)
+	}
+	r := &SdewanReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName(kind),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor(kind + "-controller"),
+		Handler:  item.handler,
+		Options:  options,
+		requeue:  make(chan event.GenericEvent, 1024),
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(item.object).
+		WithOptions(controller.Options{MaxConcurrentReconciles: options.MaxConcurrentReconciles})
+	for _, watch := range item.watches {
+		mapper := watch.Mapper
+		b = b.Watches(
+			&source.Kind{Type: watch.Object},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+					return mapper(r, o)
+				}),
+			},
+		)
+	}
+	c, err := b.Build(r)
+	if err != nil {
+		return err
+	}
+	// re-apply the CRs when the ready status of the CNF changes
+	cnfMapper := &handler.EnqueueRequestsFromMapFunc{ToRequests: cnfToRequests(r, mgr.GetScheme(), item.object)}
+	err = c.Watch(&source.Kind{Type: &extensionsv1beta1.Deployment{}}, cnfMapper, cnfDeploymentPredicate)
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, cnfMapper, cnfPodPredicate)
+	if err != nil {
+		return err
+	}
+	// re-apply the CRs with the rotated credentials or renewed certificates of the CNF
+	referenceMapper := &handler.EnqueueRequestsFromMapFunc{ToRequests: cnfReferenceToRequests(r, mgr.GetScheme(), item.object)}
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, referenceMapper)
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, referenceMapper)
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Channel{Source: r.requeue}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+	if options.GcInterval > 0 && !options.DryRun {
+		return mgr.Add(&garbageCollector{
+			client:   mgr.GetClient(),
+			scheme:   mgr.GetScheme(),
+			log:      ctrl.Log.WithName("gc").WithName(kind),
+			handler:  item.handler,
+			object:   item.object,
+			interval: options.GcInterval,
+		})
+	}
+	return nil
+}
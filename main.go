@@ -18,12 +18,16 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	batchv1alpha1 "sdewan.akraino.org/sdewan/api/v1alpha1"
+	"sdewan.akraino.org/sdewan/cnfprovider"
 	"sdewan.akraino.org/sdewan/controllers"
+	"sdewan.akraino.org/sdewan/openwrt"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	// +kubebuilder:scaffold:imports
@@ -44,15 +48,71 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var enabledControllers string
+	var resyncInterval time.Duration
+	var gcInterval time.Duration
+	var maxConcurrentReconciles int
+	var dryRun bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&enabledControllers, "controllers", "*",
+		"A comma-separated list of controllers to enable. '*' enables all the controllers, 'Kind' enables the controller of a kind and '-Kind' disables it. "+
+			"Available kinds: "+strings.Join(controllers.RegisteredKinds(), ", "))
+	flag.DurationVar(&resyncInterval, "resync-interval", 5*time.Minute,
+		"The interval to check the runtime config of the CNFs against the CRs and repair the drift. 0 disables the resync.")
+	flag.DurationVar(&gcInterval, "gc-interval", 10*time.Minute,
+		"The interval to delete the CNF objects created by the operator which have no CR any more. 0 disables the gc.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 4,
+		"The number of CRs of a kind reconciled at the same time.")
+	flag.DurationVar(&cnfprovider.BatchWindow, "batch-window", time.Second,
+		"How long a CNF service action waits for more changes, so that the changes to a service of a CNF pod share one action.")
+	flag.DurationVar(&cnfprovider.BatchMaxDelay, "batch-max-delay", 10*time.Second,
+		"The max delay of a CNF service action by a stream of changes.")
+	flag.IntVar(&cnfprovider.PodWorkers, "pod-workers", 4,
+		"The max number of CNF pods a CR is applied to at the same time.")
+	flag.DurationVar(&cnfprovider.PodTimeout, "pod-timeout", 30*time.Second,
+		"The timeout to apply a CR to one CNF pod.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Only compute the changes to the CNFs into the CR status and Events, without applying them.")
+	transportOptions := openwrt.DefaultTransportOptions
+	flag.DurationVar(&openwrt.RequestTimeout, "cnf-request-timeout", openwrt.RequestTimeout,
+		"The timeout of a request to a CNF, 0 for no timeout other than --pod-timeout.")
+	flag.DurationVar(&transportOptions.DialTimeout, "cnf-dial-timeout", transportOptions.DialTimeout,
+		"The timeout to connect to a CNF.")
+	flag.DurationVar(&transportOptions.KeepAlive, "cnf-keep-alive", transportOptions.KeepAlive,
+		"The keep-alive period of the connections to the CNFs.")
+	flag.IntVar(&transportOptions.MaxIdleConns, "cnf-max-idle-conns", transportOptions.MaxIdleConns,
+		"The max number of idle connections to all the CNF pods.")
+	flag.IntVar(&transportOptions.MaxIdleConnsPerHost, "cnf-max-idle-conns-per-pod", transportOptions.MaxIdleConnsPerHost,
+		"The max number of idle connections to one CNF pod.")
+	flag.DurationVar(&transportOptions.IdleConnTimeout, "cnf-idle-conn-timeout", transportOptions.IdleConnTimeout,
+		"How long an idle connection to a CNF is kept.")
+	flag.IntVar(&openwrt.Retry.MaxRetries, "cnf-max-retries", openwrt.Retry.MaxRetries,
+		"The max number of retries of an idempotent request to a CNF which fails with a server or transport error.")
+	flag.DurationVar(&openwrt.Retry.InitialBackoff, "cnf-retry-backoff", openwrt.Retry.InitialBackoff,
+		"The backoff before the first retry of a request to a CNF, doubled for every retry.")
+	flag.DurationVar(&openwrt.Retry.MaxBackoff, "cnf-retry-max-backoff", openwrt.Retry.MaxBackoff,
+		"The max backoff between the retries of a request to a CNF.")
+	flag.IntVar(&openwrt.CircuitBreaker.FailureThreshold, "cnf-breaker-failures", openwrt.CircuitBreaker.FailureThreshold,
+		"The number of consecutive failed requests which open the circuit breaker of a CNF pod, 0 disables it.")
+	flag.DurationVar(&openwrt.CircuitBreaker.OpenTimeout, "cnf-breaker-open-timeout", openwrt.CircuitBreaker.OpenTimeout,
+		"How long the requests to a CNF pod fail fast before the circuit breaker probes it again.")
+	flag.DurationVar(&openwrt.ClientIdleTimeout, "cnf-client-idle-timeout", openwrt.ClientIdleTimeout,
+		"How long the client and the circuit breaker of an unused CNF pod, e.g. a deleted one, are kept.")
 	flag.Parse()
+	openwrt.SetTransportOptions(transportOptions)
 
 	ctrl.SetLogger(zap.New(func(o *zap.Options) {
 		o.Development = true
 	}))
 
+	kinds, err := controllers.EnabledKinds(enabledControllers)
+	if err != nil {
+		setupLog.Error(err, "invalid controllers")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
@@ -64,13 +124,17 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.Mwan3PolicyReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Mwan3Policy"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Mwan3Policy")
-		os.Exit(1)
+	options := controllers.Options{
+		ResyncInterval:          resyncInterval,
+		GcInterval:              gcInterval,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		DryRun:                  dryRun,
+	}
+	for _, kind := range kinds {
+		if err = controllers.SetupControllerWithManager(mgr, kind, options); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", kind)
+			os.Exit(1)
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
@@ -0,0 +1,103 @@
+package openwrt
+
+import (
+	"errors"
+	"net/http"
+)
+
+// TransportError is a failure to get a response from the openwrt http server,
+// e.g. a refused connection or a timeout
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return "Transport Error: " + e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// NotFoundError is a 404 response: the object doesn't exist on the openwrt server
+type NotFoundError struct {
+	*OpenwrtError
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.OpenwrtError
+}
+
+// ConflictError is a 409 response: the object already exists or was changed on the openwrt server
+type ConflictError struct {
+	*OpenwrtError
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.OpenwrtError
+}
+
+// UnauthorizedError is a failed login, or a 401 or 403 response to a request with the session
+type UnauthorizedError struct {
+	*OpenwrtError
+}
+
+func (e *UnauthorizedError) Unwrap() error {
+	return e.OpenwrtError
+}
+
+// ServerError is a 5xx response: the openwrt server failed to handle the request
+type ServerError struct {
+	*OpenwrtError
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.OpenwrtError
+}
+
+// newOpenwrtError returns the error of a response with the type of its status code.
+// All of them unwrap to the OpenwrtError with the code and the response body.
+func newOpenwrtError(code int, message string) error {
+	err := &OpenwrtError{Code: code, Message: message}
+	switch {
+	case code == http.StatusNotFound:
+		return &NotFoundError{err}
+	case code == http.StatusConflict:
+		return &ConflictError{err}
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &UnauthorizedError{err}
+	case code >= http.StatusInternalServerError:
+		return &ServerError{err}
+	}
+	return err
+}
+
+// IsNotFound is true if the object doesn't exist on the openwrt server
+func IsNotFound(err error) bool {
+	var notFoundErr *NotFoundError
+	return errors.As(err, &notFoundErr)
+}
+
+// IsConflict is true if the object already exists or was changed on the openwrt server
+func IsConflict(err error) bool {
+	var conflictErr *ConflictError
+	return errors.As(err, &conflictErr)
+}
+
+// IsUnauthorized is true if the login failed or the session was rejected
+func IsUnauthorized(err error) bool {
+	var unauthorizedErr *UnauthorizedError
+	return errors.As(err, &unauthorizedErr)
+}
+
+// IsServerError is true if the openwrt server failed to handle the request
+func IsServerError(err error) bool {
+	var serverErr *ServerError
+	return errors.As(err, &serverErr)
+}
+
+// IsTransport is true if no response was got from the openwrt server
+func IsTransport(err error) bool {
+	var transportErr *TransportError
+	return errors.As(err, &transportErr)
+}
@@ -0,0 +1,92 @@
+package openwrt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		name             string
+		err              error
+		wantNotFound     bool
+		wantConflict     bool
+		wantUnauthorized bool
+		wantServer       bool
+		wantTransport    bool
+		// the status code of the wrapped OpenwrtError, 0 if there is none
+		wantCode int
+	}{
+		{name: "404", err: newOpenwrtError(http.StatusNotFound, ""), wantNotFound: true, wantCode: 404},
+		{name: "409", err: newOpenwrtError(http.StatusConflict, ""), wantConflict: true, wantCode: 409},
+		{name: "401", err: newOpenwrtError(http.StatusUnauthorized, ""), wantUnauthorized: true, wantCode: 401},
+		{name: "403", err: newOpenwrtError(http.StatusForbidden, ""), wantUnauthorized: true, wantCode: 403},
+		{name: "500", err: newOpenwrtError(http.StatusInternalServerError, ""), wantServer: true, wantCode: 500},
+		{name: "503", err: newOpenwrtError(http.StatusServiceUnavailable, ""), wantServer: true, wantCode: 503},
+		{name: "400", err: newOpenwrtError(http.StatusBadRequest, ""), wantCode: 400},
+		{name: "transport", err: &TransportError{Err: errors.New("connection refused")}, wantTransport: true},
+		{name: "wrapped 404", err: fmt.Errorf("Failed to get: %w", newOpenwrtError(http.StatusNotFound, "")), wantNotFound: true, wantCode: 404},
+		{name: "wrapped transport", err: fmt.Errorf("Failed to get: %w", &TransportError{Err: context.DeadlineExceeded}), wantTransport: true},
+		{name: "other", err: errors.New("invalid json")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsNotFound(test.err); got != test.wantNotFound {
+				t.Errorf("IsNotFound got %v", got)
+			}
+			if got := IsConflict(test.err); got != test.wantConflict {
+				t.Errorf("IsConflict got %v", got)
+			}
+			if got := IsUnauthorized(test.err); got != test.wantUnauthorized {
+				t.Errorf("IsUnauthorized got %v", got)
+			}
+			if got := IsServerError(test.err); got != test.wantServer {
+				t.Errorf("IsServerError got %v", got)
+			}
+			if got := IsTransport(test.err); got != test.wantTransport {
+				t.Errorf("IsTransport got %v", got)
+			}
+			var openwrtErr *OpenwrtError
+			code := 0
+			if errors.As(test.err, &openwrtErr) {
+				code = openwrtErr.Code
+			}
+			if code != test.wantCode {
+				t.Errorf("got code %d, want %d", code, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestCallReturnsTypedErrors(t *testing.T) {
+	setPolicies(t, 0, 0, 0)
+	tests := []struct {
+		status int
+		check  func(error) bool
+	}{
+		{status: http.StatusNotFound, check: func(err error) bool {
+			var e *NotFoundError
+			return errors.As(err, &e)
+		}},
+		{status: http.StatusConflict, check: func(err error) bool {
+			var e *ConflictError
+			return errors.As(err, &e)
+		}},
+		{status: http.StatusInternalServerError, check: func(err error) bool {
+			var e *ServerError
+			return errors.As(err, &e)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			f := newFakeLuci(t, failingHandler(1, test.status))
+			_, err := GetOpenwrtClient(f.clientInfo(t)).Get(context.Background(), "sdewan/v1/test")
+			if !test.check(err) {
+				t.Errorf("got error %#v", err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package openwrt
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -92,12 +93,28 @@ type SdewanFirewallRedirects struct {
 	Redirects []SdewanFirewallRedirect `json:"redirects"`
 }
 
+func (o *SdewanFirewallZone) GetName() string {
+	return o.Name
+}
+
+func (o *SdewanFirewallRule) GetName() string {
+	return o.Name
+}
+
+func (o *SdewanFirewallRedirect) GetName() string {
+	return o.Name
+}
+
+func (o *SdewanFirewallForwarding) GetName() string {
+	return o.Name
+}
+
 // Zone APIs
 // get zones
-func (f *FirewallClient) GetZones() (*SdewanFirewallZones, error) {
+func (f *FirewallClient) GetZones(ctx context.Context) (*SdewanFirewallZones, error) {
 	var response string
 	var err error
-	response, err = f.OpenwrtClient.Get(firewallBaseURL + "zones")
+	response, err = f.OpenwrtClient.Get(ctx, firewallBaseURL+"zones")
 	if err != nil {
 		return nil, err
 	}
@@ -112,10 +129,10 @@ func (f *FirewallClient) GetZones() (*SdewanFirewallZones, error) {
 }
 
 // get zone
-func (m *FirewallClient) GetZone(zone string) (*SdewanFirewallZone, error) {
+func (m *FirewallClient) GetZone(ctx context.Context, zone string) (*SdewanFirewallZone, error) {
 	var response string
 	var err error
-	response, err = m.OpenwrtClient.Get(firewallBaseURL + "zones/" + zone)
+	response, err = m.OpenwrtClient.Get(ctx, firewallBaseURL+"zones/"+zone)
 	if err != nil {
 		return nil, err
 	}
@@ -130,11 +147,11 @@ func (m *FirewallClient) GetZone(zone string) (*SdewanFirewallZone, error) {
 }
 
 // create zone
-func (m *FirewallClient) CreateZone(zone SdewanFirewallZone) (*SdewanFirewallZone, error) {
+func (m *FirewallClient) CreateZone(ctx context.Context, zone SdewanFirewallZone) (*SdewanFirewallZone, error) {
 	var response string
 	var err error
 	zone_obj, _ := json.Marshal(zone)
-	response, err = m.OpenwrtClient.Post(firewallBaseURL+"zones", string(zone_obj))
+	response, err = m.OpenwrtClient.Post(ctx, firewallBaseURL+"zones", string(zone_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -149,8 +166,8 @@ func (m *FirewallClient) CreateZone(zone SdewanFirewallZone) (*SdewanFirewallZon
 }
 
 // delete zone
-func (m *FirewallClient) DeleteZone(zone_name string) error {
-	_, err := m.OpenwrtClient.Delete(firewallBaseURL + "zones/" + zone_name)
+func (m *FirewallClient) DeleteZone(ctx context.Context, zone_name string) error {
+	_, err := m.OpenwrtClient.Delete(ctx, firewallBaseURL+"zones/"+zone_name)
 	if err != nil {
 		return err
 	}
@@ -159,12 +176,12 @@ func (m *FirewallClient) DeleteZone(zone_name string) error {
 }
 
 // update zone
-func (m *FirewallClient) UpdateZone(zone SdewanFirewallZone) (*SdewanFirewallZone, error) {
+func (m *FirewallClient) UpdateZone(ctx context.Context, zone SdewanFirewallZone) (*SdewanFirewallZone, error) {
 	var response string
 	var err error
 	zone_obj, _ := json.Marshal(zone)
 	zone_name := zone.Name
-	response, err = m.OpenwrtClient.Put(firewallBaseURL+"zones/"+zone_name, string(zone_obj))
+	response, err = m.OpenwrtClient.Put(ctx, firewallBaseURL+"zones/"+zone_name, string(zone_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -180,10 +197,10 @@ func (m *FirewallClient) UpdateZone(zone SdewanFirewallZone) (*SdewanFirewallZon
 
 // Rule APIs
 // get rules
-func (f *FirewallClient) GetRules() (*SdewanFirewallRules, error) {
+func (f *FirewallClient) GetRules(ctx context.Context) (*SdewanFirewallRules, error) {
 	var response string
 	var err error
-	response, err = f.OpenwrtClient.Get(firewallBaseURL + "rules")
+	response, err = f.OpenwrtClient.Get(ctx, firewallBaseURL+"rules")
 	if err != nil {
 		return nil, err
 	}
@@ -198,10 +215,10 @@ func (f *FirewallClient) GetRules() (*SdewanFirewallRules, error) {
 }
 
 // get rule
-func (m *FirewallClient) GetRule(rule string) (*SdewanFirewallRule, error) {
+func (m *FirewallClient) GetRule(ctx context.Context, rule string) (*SdewanFirewallRule, error) {
 	var response string
 	var err error
-	response, err = m.OpenwrtClient.Get(firewallBaseURL + "rules/" + rule)
+	response, err = m.OpenwrtClient.Get(ctx, firewallBaseURL+"rules/"+rule)
 	if err != nil {
 		return nil, err
 	}
@@ -216,11 +233,11 @@ func (m *FirewallClient) GetRule(rule string) (*SdewanFirewallRule, error) {
 }
 
 // create rule
-func (m *FirewallClient) CreateRule(rule SdewanFirewallRule) (*SdewanFirewallRule, error) {
+func (m *FirewallClient) CreateRule(ctx context.Context, rule SdewanFirewallRule) (*SdewanFirewallRule, error) {
 	var response string
 	var err error
 	rule_obj, _ := json.Marshal(rule)
-	response, err = m.OpenwrtClient.Post(firewallBaseURL+"rules", string(rule_obj))
+	response, err = m.OpenwrtClient.Post(ctx, firewallBaseURL+"rules", string(rule_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -235,8 +252,8 @@ func (m *FirewallClient) CreateRule(rule SdewanFirewallRule) (*SdewanFirewallRul
 }
 
 // delete rule
-func (m *FirewallClient) DeleteRule(rule_name string) error {
-	_, err := m.OpenwrtClient.Delete(firewallBaseURL + "rules/" + rule_name)
+func (m *FirewallClient) DeleteRule(ctx context.Context, rule_name string) error {
+	_, err := m.OpenwrtClient.Delete(ctx, firewallBaseURL+"rules/"+rule_name)
 	if err != nil {
 		return err
 	}
@@ -245,12 +262,12 @@ func (m *FirewallClient) DeleteRule(rule_name string) error {
 }
 
 // update rule
-func (m *FirewallClient) UpdateRule(rule SdewanFirewallRule) (*SdewanFirewallRule, error) {
+func (m *FirewallClient) UpdateRule(ctx context.Context, rule SdewanFirewallRule) (*SdewanFirewallRule, error) {
 	var response string
 	var err error
 	rule_obj, _ := json.Marshal(rule)
 	rule_name := rule.Name
-	response, err = m.OpenwrtClient.Put(firewallBaseURL+"rules/"+rule_name, string(rule_obj))
+	response, err = m.OpenwrtClient.Put(ctx, firewallBaseURL+"rules/"+rule_name, string(rule_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -266,10 +283,10 @@ func (m *FirewallClient) UpdateRule(rule SdewanFirewallRule) (*SdewanFirewallRul
 
 // Forwarding APIs
 // get forwardings
-func (f *FirewallClient) GetForwardings() (*SdewanFirewallForwardings, error) {
+func (f *FirewallClient) GetForwardings(ctx context.Context) (*SdewanFirewallForwardings, error) {
 	var response string
 	var err error
-	response, err = f.OpenwrtClient.Get(firewallBaseURL + "forwardings")
+	response, err = f.OpenwrtClient.Get(ctx, firewallBaseURL+"forwardings")
 	if err != nil {
 		return nil, err
 	}
@@ -284,10 +301,10 @@ func (f *FirewallClient) GetForwardings() (*SdewanFirewallForwardings, error) {
 }
 
 // get forwarding
-func (m *FirewallClient) GetForwarding(forwarding string) (*SdewanFirewallForwarding, error) {
+func (m *FirewallClient) GetForwarding(ctx context.Context, forwarding string) (*SdewanFirewallForwarding, error) {
 	var response string
 	var err error
-	response, err = m.OpenwrtClient.Get(firewallBaseURL + "forwardings/" + forwarding)
+	response, err = m.OpenwrtClient.Get(ctx, firewallBaseURL+"forwardings/"+forwarding)
 	if err != nil {
 		return nil, err
 	}
@@ -302,11 +319,11 @@ func (m *FirewallClient) GetForwarding(forwarding string) (*SdewanFirewallForwar
 }
 
 // create forwarding
-func (m *FirewallClient) CreateForwarding(forwarding SdewanFirewallForwarding) (*SdewanFirewallForwarding, error) {
+func (m *FirewallClient) CreateForwarding(ctx context.Context, forwarding SdewanFirewallForwarding) (*SdewanFirewallForwarding, error) {
 	var response string
 	var err error
 	forwarding_obj, _ := json.Marshal(forwarding)
-	response, err = m.OpenwrtClient.Post(firewallBaseURL+"forwardings", string(forwarding_obj))
+	response, err = m.OpenwrtClient.Post(ctx, firewallBaseURL+"forwardings", string(forwarding_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -321,8 +338,8 @@ func (m *FirewallClient) CreateForwarding(forwarding SdewanFirewallForwarding) (
 }
 
 // delete forwarding
-func (m *FirewallClient) DeleteForwarding(forwarding_name string) error {
-	_, err := m.OpenwrtClient.Delete(firewallBaseURL + "forwardings/" + forwarding_name)
+func (m *FirewallClient) DeleteForwarding(ctx context.Context, forwarding_name string) error {
+	_, err := m.OpenwrtClient.Delete(ctx, firewallBaseURL+"forwardings/"+forwarding_name)
 	if err != nil {
 		return err
 	}
@@ -331,12 +348,12 @@ func (m *FirewallClient) DeleteForwarding(forwarding_name string) error {
 }
 
 // update forwarding
-func (m *FirewallClient) UpdateForwarding(forwarding SdewanFirewallForwarding) (*SdewanFirewallForwarding, error) {
+func (m *FirewallClient) UpdateForwarding(ctx context.Context, forwarding SdewanFirewallForwarding) (*SdewanFirewallForwarding, error) {
 	var response string
 	var err error
 	forwarding_obj, _ := json.Marshal(forwarding)
 	forwarding_name := forwarding.Name
-	response, err = m.OpenwrtClient.Put(firewallBaseURL+"forwardings/"+forwarding_name, string(forwarding_obj))
+	response, err = m.OpenwrtClient.Put(ctx, firewallBaseURL+"forwardings/"+forwarding_name, string(forwarding_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -352,10 +369,10 @@ func (m *FirewallClient) UpdateForwarding(forwarding SdewanFirewallForwarding) (
 
 // Redirect APIs
 // get redirects
-func (f *FirewallClient) GetRedirects() (*SdewanFirewallRedirects, error) {
+func (f *FirewallClient) GetRedirects(ctx context.Context) (*SdewanFirewallRedirects, error) {
 	var response string
 	var err error
-	response, err = f.OpenwrtClient.Get(firewallBaseURL + "redirects")
+	response, err = f.OpenwrtClient.Get(ctx, firewallBaseURL+"redirects")
 	if err != nil {
 		return nil, err
 	}
@@ -370,10 +387,10 @@ func (f *FirewallClient) GetRedirects() (*SdewanFirewallRedirects, error) {
 }
 
 // get redirect
-func (m *FirewallClient) GetRedirect(redirect string) (*SdewanFirewallRedirect, error) {
+func (m *FirewallClient) GetRedirect(ctx context.Context, redirect string) (*SdewanFirewallRedirect, error) {
 	var response string
 	var err error
-	response, err = m.OpenwrtClient.Get(firewallBaseURL + "redirects/" + redirect)
+	response, err = m.OpenwrtClient.Get(ctx, firewallBaseURL+"redirects/"+redirect)
 	if err != nil {
 		return nil, err
 	}
@@ -388,11 +405,11 @@ func (m *FirewallClient) GetRedirect(redirect string) (*SdewanFirewallRedirect,
 }
 
 // create redirect
-func (m *FirewallClient) CreateRedirect(redirect SdewanFirewallRedirect) (*SdewanFirewallRedirect, error) {
+func (m *FirewallClient) CreateRedirect(ctx context.Context, redirect SdewanFirewallRedirect) (*SdewanFirewallRedirect, error) {
 	var response string
 	var err error
 	redirect_obj, _ := json.Marshal(redirect)
-	response, err = m.OpenwrtClient.Post(firewallBaseURL+"redirects", string(redirect_obj))
+	response, err = m.OpenwrtClient.Post(ctx, firewallBaseURL+"redirects", string(redirect_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -407,8 +424,8 @@ func (m *FirewallClient) CreateRedirect(redirect SdewanFirewallRedirect) (*Sdewa
 }
 
 // delete redirect
-func (m *FirewallClient) DeleteRedirect(redirect_name string) error {
-	_, err := m.OpenwrtClient.Delete(firewallBaseURL + "redirects/" + redirect_name)
+func (m *FirewallClient) DeleteRedirect(ctx context.Context, redirect_name string) error {
+	_, err := m.OpenwrtClient.Delete(ctx, firewallBaseURL+"redirects/"+redirect_name)
 	if err != nil {
 		return err
 	}
@@ -417,12 +434,12 @@ func (m *FirewallClient) DeleteRedirect(redirect_name string) error {
 }
 
 // update redirect
-func (m *FirewallClient) UpdateRedirect(redirect SdewanFirewallRedirect) (*SdewanFirewallRedirect, error) {
+func (m *FirewallClient) UpdateRedirect(ctx context.Context, redirect SdewanFirewallRedirect) (*SdewanFirewallRedirect, error) {
 	var response string
 	var err error
 	redirect_obj, _ := json.Marshal(redirect)
 	redirect_name := redirect.Name
-	response, err = m.OpenwrtClient.Put(firewallBaseURL+"redirects/"+redirect_name, string(redirect_obj))
+	response, err = m.OpenwrtClient.Put(ctx, firewallBaseURL+"redirects/"+redirect_name, string(redirect_obj))
 	if err != nil {
 		return nil, err
 	}
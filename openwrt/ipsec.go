@@ -1,6 +1,7 @@
 package openwrt
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -41,18 +42,19 @@ type SdewanIpsecConnection struct {
 	CryptoProposal []string `json:"crypto_proposal"`
 }
 
+// The fields tagged diff:"masked" are never shown in the diff of a dry run plan
 type SdewanIpsecSite struct {
 	Name                 string                  `json:"name"`
 	Gateway              string                  `json:"gateway"`
-	PreSharedKey         string                  `json:"pre_shared_key"`
+	PreSharedKey         string                  `json:"pre_shared_key" diff:"masked"`
 	AuthenticationMethod string                  `json:"authentication_method"`
 	LocalIdentifier      string                  `json:"local_identifier"`
 	RemoteIdentifier     string                  `json:"remote_identifier"`
 	CryptoProposal       []string                `json:"crypto_proposal"`
 	ForceCryptoProposal  string                  `json:"force_crypto_proposal"`
-	LocalPublicCert      string                  `json:"local_public_cert"`
-	LocalPrivateCert     string                  `json:"local_private_cert"`
-	SharedCa             string                  `json:"shared_ca"`
+	LocalPublicCert      string                  `json:"local_public_cert" diff:"masked"`
+	LocalPrivateCert     string                  `json:"local_private_cert" diff:"masked"`
+	SharedCa             string                  `json:"shared_ca" diff:"masked"`
 	Connections          []SdewanIpsecConnection `json:"connections"`
 }
 
@@ -60,12 +62,44 @@ type SdewanIpsecSites struct {
 	Sites []SdewanIpsecSite `json:"sites"`
 }
 
+// IKE SA states of SdewanIpsecConnectionStatus and child SA states of SdewanIpsecChildSaStatus
+const (
+	IpsecSaStateEstablished = "ESTABLISHED"
+	IpsecSaStateInstalled   = "INSTALLED"
+)
+
+// Status of the child SA of a connection
+type SdewanIpsecChildSaStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// Status of the IKE connection of a site, which has the name of the site.
+// State is empty when the connection is loaded but has no IKE SA.
+type SdewanIpsecConnectionStatus struct {
+	Name     string                     `json:"name"`
+	State    string                     `json:"state"`
+	Children []SdewanIpsecChildSaStatus `json:"children"`
+}
+
+type SdewanIpsecStatus struct {
+	Connections []SdewanIpsecConnectionStatus `json:"connections"`
+}
+
+func (o *SdewanIpsecProposal) GetName() string {
+	return o.Name
+}
+
+func (o *SdewanIpsecSite) GetName() string {
+	return o.Name
+}
+
 // Proposal APIs
 // get proposals
-func (f *IpsecClient) GetProposals() (*SdewanIpsecProposals, error) {
+func (f *IpsecClient) GetProposals(ctx context.Context) (*SdewanIpsecProposals, error) {
 	var response string
 	var err error
-	response, err = f.OpenwrtClient.Get(ipsecBaseURL + "proposals")
+	response, err = f.OpenwrtClient.Get(ctx, ipsecBaseURL+"proposals")
 	if err != nil {
 		return nil, err
 	}
@@ -80,10 +114,10 @@ func (f *IpsecClient) GetProposals() (*SdewanIpsecProposals, error) {
 }
 
 // get proposal
-func (m *IpsecClient) GetProposal(proposal string) (*SdewanIpsecProposal, error) {
+func (m *IpsecClient) GetProposal(ctx context.Context, proposal string) (*SdewanIpsecProposal, error) {
 	var response string
 	var err error
-	response, err = m.OpenwrtClient.Get(ipsecBaseURL + "proposals/" + proposal)
+	response, err = m.OpenwrtClient.Get(ctx, ipsecBaseURL+"proposals/"+proposal)
 	if err != nil {
 		return nil, err
 	}
@@ -98,11 +132,11 @@ func (m *IpsecClient) GetProposal(proposal string) (*SdewanIpsecProposal, error)
 }
 
 // create proposal
-func (m *IpsecClient) CreateProposal(proposal SdewanIpsecProposal) (*SdewanIpsecProposal, error) {
+func (m *IpsecClient) CreateProposal(ctx context.Context, proposal SdewanIpsecProposal) (*SdewanIpsecProposal, error) {
 	var response string
 	var err error
 	proposal_obj, _ := json.Marshal(proposal)
-	response, err = m.OpenwrtClient.Post(ipsecBaseURL+"proposals", string(proposal_obj))
+	response, err = m.OpenwrtClient.Post(ctx, ipsecBaseURL+"proposals", string(proposal_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +151,8 @@ func (m *IpsecClient) CreateProposal(proposal SdewanIpsecProposal) (*SdewanIpsec
 }
 
 // delete proposal
-func (m *IpsecClient) DeleteProposal(proposal_name string) error {
-	_, err := m.OpenwrtClient.Delete(ipsecBaseURL + "proposals/" + proposal_name)
+func (m *IpsecClient) DeleteProposal(ctx context.Context, proposal_name string) error {
+	_, err := m.OpenwrtClient.Delete(ctx, ipsecBaseURL+"proposals/"+proposal_name)
 	if err != nil {
 		return err
 	}
@@ -127,12 +161,12 @@ func (m *IpsecClient) DeleteProposal(proposal_name string) error {
 }
 
 // update proposal
-func (m *IpsecClient) UpdateProposal(proposal SdewanIpsecProposal) (*SdewanIpsecProposal, error) {
+func (m *IpsecClient) UpdateProposal(ctx context.Context, proposal SdewanIpsecProposal) (*SdewanIpsecProposal, error) {
 	var response string
 	var err error
 	proposal_obj, _ := json.Marshal(proposal)
 	proposal_name := proposal.Name
-	response, err = m.OpenwrtClient.Put(ipsecBaseURL+"proposals/"+proposal_name, string(proposal_obj))
+	response, err = m.OpenwrtClient.Put(ctx, ipsecBaseURL+"proposals/"+proposal_name, string(proposal_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -148,10 +182,10 @@ func (m *IpsecClient) UpdateProposal(proposal SdewanIpsecProposal) (*SdewanIpsec
 
 // Site APIs
 // get sites
-func (f *IpsecClient) GetSites() (*SdewanIpsecSites, error) {
+func (f *IpsecClient) GetSites(ctx context.Context) (*SdewanIpsecSites, error) {
 	var response string
 	var err error
-	response, err = f.OpenwrtClient.Get(ipsecBaseURL + "sites")
+	response, err = f.OpenwrtClient.Get(ctx, ipsecBaseURL+"sites")
 	if err != nil {
 		return nil, err
 	}
@@ -166,10 +200,10 @@ func (f *IpsecClient) GetSites() (*SdewanIpsecSites, error) {
 }
 
 // get site
-func (m *IpsecClient) GetSite(site string) (*SdewanIpsecSite, error) {
+func (m *IpsecClient) GetSite(ctx context.Context, site string) (*SdewanIpsecSite, error) {
 	var response string
 	var err error
-	response, err = m.OpenwrtClient.Get(ipsecBaseURL + "sites/" + site)
+	response, err = m.OpenwrtClient.Get(ctx, ipsecBaseURL+"sites/"+site)
 	if err != nil {
 		return nil, err
 	}
@@ -184,11 +218,11 @@ func (m *IpsecClient) GetSite(site string) (*SdewanIpsecSite, error) {
 }
 
 // create site
-func (m *IpsecClient) CreateSite(site SdewanIpsecSite) (*SdewanIpsecSite, error) {
+func (m *IpsecClient) CreateSite(ctx context.Context, site SdewanIpsecSite) (*SdewanIpsecSite, error) {
 	var response string
 	var err error
 	site_obj, _ := json.Marshal(site)
-	response, err = m.OpenwrtClient.Post(ipsecBaseURL+"sites", string(site_obj))
+	response, err = m.OpenwrtClient.Post(ctx, ipsecBaseURL+"sites", string(site_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -203,8 +237,8 @@ func (m *IpsecClient) CreateSite(site SdewanIpsecSite) (*SdewanIpsecSite, error)
 }
 
 // delete site
-func (m *IpsecClient) DeleteSite(site_name string) error {
-	_, err := m.OpenwrtClient.Delete(ipsecBaseURL + "sites/" + site_name)
+func (m *IpsecClient) DeleteSite(ctx context.Context, site_name string) error {
+	_, err := m.OpenwrtClient.Delete(ctx, ipsecBaseURL+"sites/"+site_name)
 	if err != nil {
 		return err
 	}
@@ -213,12 +247,12 @@ func (m *IpsecClient) DeleteSite(site_name string) error {
 }
 
 // update site
-func (m *IpsecClient) UpdateSite(site SdewanIpsecSite) (*SdewanIpsecSite, error) {
+func (m *IpsecClient) UpdateSite(ctx context.Context, site SdewanIpsecSite) (*SdewanIpsecSite, error) {
 	var response string
 	var err error
 	site_obj, _ := json.Marshal(site)
 	site_name := site.Name
-	response, err = m.OpenwrtClient.Put(ipsecBaseURL+"sites/"+site_name, string(site_obj))
+	response, err = m.OpenwrtClient.Put(ctx, ipsecBaseURL+"sites/"+site_name, string(site_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -231,3 +265,22 @@ func (m *IpsecClient) UpdateSite(site SdewanIpsecSite) (*SdewanIpsecSite, error)
 
 	return &sdewanIpsecSite, nil
 }
+
+// Status APIs
+// get the status of the loaded connections and their SAs
+func (m *IpsecClient) GetConnectionStatus(ctx context.Context) (*SdewanIpsecStatus, error) {
+	var response string
+	var err error
+	response, err = m.OpenwrtClient.Get(ctx, ipsecBaseURL+"status")
+	if err != nil {
+		return nil, err
+	}
+
+	var sdewanIpsecStatus SdewanIpsecStatus
+	err = json.Unmarshal([]byte(response), &sdewanIpsecStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sdewanIpsecStatus, nil
+}
@@ -0,0 +1,27 @@
+package openwrt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	circuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sdewan_cnf_circuit_breaker_state",
+			Help: "State of the circuit breaker of the cnf pod endpoints (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"endpoint"},
+	)
+	requestRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sdewan_cnf_request_retries_total",
+			Help: "Number of retried requests to the cnf pod endpoints",
+		},
+		[]string{"endpoint", "method"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(circuitBreakerState, requestRetries)
+}
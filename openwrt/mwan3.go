@@ -1,6 +1,7 @@
 package openwrt
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -78,8 +79,8 @@ func (o *SdewanRule) GetName() string {
 }
 
 // get interface status
-func (m *Mwan3Client) GetInterfaceStatus() (*InterfaceStatus, error) {
-	response, err := m.OpenwrtClient.Get("admin/status/mwan/interface_status")
+func (m *Mwan3Client) GetInterfaceStatus(ctx context.Context) (*InterfaceStatus, error) {
+	response, err := m.OpenwrtClient.Get(ctx, "admin/status/mwan/interface_status")
 	if err != nil {
 		return nil, err
 	}
@@ -95,8 +96,8 @@ func (m *Mwan3Client) GetInterfaceStatus() (*InterfaceStatus, error) {
 
 // Policy APIs
 // get policies
-func (m *Mwan3Client) GetPolicies() (*SdewanPolicies, error) {
-	response, err := m.OpenwrtClient.Get(mwan3BaseURL + "policies")
+func (m *Mwan3Client) GetPolicies(ctx context.Context) (*SdewanPolicies, error) {
+	response, err := m.OpenwrtClient.Get(ctx, mwan3BaseURL+"policies")
 	if err != nil {
 		return nil, err
 	}
@@ -111,8 +112,8 @@ func (m *Mwan3Client) GetPolicies() (*SdewanPolicies, error) {
 }
 
 // get policy
-func (m *Mwan3Client) GetPolicy(policy_name string) (*SdewanPolicy, error) {
-	response, err := m.OpenwrtClient.Get(mwan3BaseURL + "policies/" + policy_name)
+func (m *Mwan3Client) GetPolicy(ctx context.Context, policy_name string) (*SdewanPolicy, error) {
+	response, err := m.OpenwrtClient.Get(ctx, mwan3BaseURL+"policies/"+policy_name)
 	if err != nil {
 		return nil, err
 	}
@@ -127,9 +128,9 @@ func (m *Mwan3Client) GetPolicy(policy_name string) (*SdewanPolicy, error) {
 }
 
 // create policy
-func (m *Mwan3Client) CreatePolicy(policy SdewanPolicy) (*SdewanPolicy, error) {
+func (m *Mwan3Client) CreatePolicy(ctx context.Context, policy SdewanPolicy) (*SdewanPolicy, error) {
 	policy_obj, _ := json.Marshal(policy)
-	response, err := m.OpenwrtClient.Post(mwan3BaseURL+"policies", string(policy_obj))
+	response, err := m.OpenwrtClient.Post(ctx, mwan3BaseURL+"policies", string(policy_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -144,8 +145,8 @@ func (m *Mwan3Client) CreatePolicy(policy SdewanPolicy) (*SdewanPolicy, error) {
 }
 
 // delete policy
-func (m *Mwan3Client) DeletePolicy(policy_name string) error {
-	_, err := m.OpenwrtClient.Delete(mwan3BaseURL + "policies/" + policy_name)
+func (m *Mwan3Client) DeletePolicy(ctx context.Context, policy_name string) error {
+	_, err := m.OpenwrtClient.Delete(ctx, mwan3BaseURL+"policies/"+policy_name)
 	if err != nil {
 		return err
 	}
@@ -154,10 +155,10 @@ func (m *Mwan3Client) DeletePolicy(policy_name string) error {
 }
 
 // update policy
-func (m *Mwan3Client) UpdatePolicy(policy SdewanPolicy) (*SdewanPolicy, error) {
+func (m *Mwan3Client) UpdatePolicy(ctx context.Context, policy SdewanPolicy) (*SdewanPolicy, error) {
 	policy_obj, _ := json.Marshal(policy)
 	policy_name := policy.Name
-	response, err := m.OpenwrtClient.Put(mwan3BaseURL+"policies/"+policy_name, string(policy_obj))
+	response, err := m.OpenwrtClient.Put(ctx, mwan3BaseURL+"policies/"+policy_name, string(policy_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -173,8 +174,8 @@ func (m *Mwan3Client) UpdatePolicy(policy SdewanPolicy) (*SdewanPolicy, error) {
 
 // Rule APIs
 // get rules
-func (m *Mwan3Client) GetRules() (*SdewanRules, error) {
-	response, err := m.OpenwrtClient.Get(mwan3BaseURL + "rules")
+func (m *Mwan3Client) GetRules(ctx context.Context) (*SdewanRules, error) {
+	response, err := m.OpenwrtClient.Get(ctx, mwan3BaseURL+"rules")
 	if err != nil {
 		return nil, err
 	}
@@ -189,8 +190,8 @@ func (m *Mwan3Client) GetRules() (*SdewanRules, error) {
 }
 
 // get rule
-func (m *Mwan3Client) GetRule(rule string) (*SdewanRule, error) {
-	response, err := m.OpenwrtClient.Get(mwan3BaseURL + "rules/" + rule)
+func (m *Mwan3Client) GetRule(ctx context.Context, rule string) (*SdewanRule, error) {
+	response, err := m.OpenwrtClient.Get(ctx, mwan3BaseURL+"rules/"+rule)
 	if err != nil {
 		return nil, err
 	}
@@ -205,9 +206,9 @@ func (m *Mwan3Client) GetRule(rule string) (*SdewanRule, error) {
 }
 
 // create rule
-func (m *Mwan3Client) CreateRule(rule SdewanRule) (*SdewanRule, error) {
+func (m *Mwan3Client) CreateRule(ctx context.Context, rule SdewanRule) (*SdewanRule, error) {
 	rule_obj, _ := json.Marshal(rule)
-	response, err := m.OpenwrtClient.Post(mwan3BaseURL+"rules", string(rule_obj))
+	response, err := m.OpenwrtClient.Post(ctx, mwan3BaseURL+"rules", string(rule_obj))
 	if err != nil {
 		return nil, err
 	}
@@ -222,8 +223,8 @@ func (m *Mwan3Client) CreateRule(rule SdewanRule) (*SdewanRule, error) {
 }
 
 // delete rule
-func (m *Mwan3Client) DeleteRule(rule_name string) error {
-	_, err := m.OpenwrtClient.Delete(mwan3BaseURL + "rules/" + rule_name)
+func (m *Mwan3Client) DeleteRule(ctx context.Context, rule_name string) error {
+	_, err := m.OpenwrtClient.Delete(ctx, mwan3BaseURL+"rules/"+rule_name)
 	if err != nil {
 		return err
 	}
@@ -232,10 +233,10 @@ func (m *Mwan3Client) DeleteRule(rule_name string) error {
 }
 
 // update rule
-func (m *Mwan3Client) UpdateRule(rule SdewanRule) (*SdewanRule, error) {
+func (m *Mwan3Client) UpdateRule(ctx context.Context, rule SdewanRule) (*SdewanRule, error) {
 	rule_obj, _ := json.Marshal(rule)
 	rule_name := rule.Name
-	response, err := m.OpenwrtClient.Put(mwan3BaseURL+"rules/"+rule_name, string(rule_obj))
+	response, err := m.OpenwrtClient.Put(ctx, mwan3BaseURL+"rules/"+rule_name, string(rule_obj))
 	if err != nil {
 		return nil, err
 	}
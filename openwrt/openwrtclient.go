@@ -2,12 +2,17 @@ package openwrt
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type IOpenWrtObject interface {
@@ -27,11 +32,37 @@ type OpenwrtClientInfo struct {
 	Ip       string
 	User     string
 	Password string
+	// http (default) or https
+	Scheme string
+	// the port of the openwrt http server, the default port of the scheme if 0
+	Port int
+	// the TLS setting used with https
+	TLS *TLSConfig
+}
+
+// key identifies the client info in the cached clients, without keeping the password
+func (c *OpenwrtClientInfo) key() string {
+	h := sha256.New()
+	for _, value := range []string{c.User, c.Password, c.Scheme, strconv.Itoa(c.Port), c.TLS.hash()} {
+		h.Write([]byte(strconv.Itoa(len(value))))
+		h.Write([]byte(value))
+	}
+	return fmt.Sprintf("%s-%x", c.Ip, h.Sum(nil))
 }
 
 type openwrtClient struct {
 	OpenwrtClientInfo
-	token string
+	// the client is shared by the concurrent reconciles, mu guards the token
+	// so that only one of them logs in when the token is missing or expired
+	mu        sync.Mutex
+	token     string
+	transport http.RoundTripper
+	err       error
+	// the last time the client was got from the cache, guarded by the mux of the cache
+	lastUsed time.Time
+	// the actions supported by the services of the pod, asked once per client
+	capabilitiesMu sync.Mutex
+	capabilities   ServiceCapabilities
 }
 
 type safeOpenwrtClient struct {
@@ -39,31 +70,53 @@ type safeOpenwrtClient struct {
 	mux     sync.Mutex
 }
 
+// ClientIdleTimeout is the time after which an unused client is dropped from the cache, together
+// with the circuit breaker of its pod. The clients of the deleted cnf pods are dropped this way.
+var ClientIdleTimeout = 30 * time.Minute
+
 var gclients = safeOpenwrtClient{clients: make(map[string]*openwrtClient)}
 
 func CloseClient(o *openwrtClient) {
-	o.logout()
+	o.logout(context.Background())
 	runtime.SetFinalizer(o, nil)
 }
 
 func GetOpenwrtClient(clientInfo OpenwrtClientInfo) *openwrtClient {
-	return gclients.GetClient(clientInfo.Ip, clientInfo.User, clientInfo.Password)
+	return gclients.GetClient(clientInfo)
 }
 
 // SafeOpenwrtClients
-func (s *safeOpenwrtClient) GetClient(ip string, user string, password string) *openwrtClient {
+func (s *safeOpenwrtClient) GetClient(clientInfo OpenwrtClientInfo) *openwrtClient {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	key := ip + "-" + user + "-" + password
+	now := time.Now()
+	key := clientInfo.key()
+	removed := false
+	for k, c := range s.clients {
+		// the credentials or the TLS setting of the cnf are changed, or the client is not used anymore
+		if (k != key && c.Ip == clientInfo.Ip) || now.Sub(c.lastUsed) > ClientIdleTimeout {
+			delete(s.clients, k)
+			go c.closeSession(RequestTimeout)
+			removed = true
+		}
+	}
 	if s.clients[key] == nil {
+		// an invalid TLS setting fails all the calls of the client
+		transport, err := newTransport(clientInfo)
 		s.clients[key] = &openwrtClient{
-			OpenwrtClientInfo: OpenwrtClientInfo{
-				Ip:       ip,
-				User:     user,
-				Password: password,
-			},
-			token: "",
+			OpenwrtClientInfo: clientInfo,
+			token:             "",
+			transport:         transport,
+			err:               err,
+		}
+	}
+	s.clients[key].lastUsed = now
+	if removed {
+		endpoints := map[string]bool{}
+		for _, c := range s.clients {
+			endpoints[c.getBaseURL()] = true
 		}
+		retainCircuitBreakers(endpoints)
 	}
 
 	return s.clients[key]
@@ -71,12 +124,43 @@ func (s *safeOpenwrtClient) GetClient(ip string, user string, password string) *
 
 // openwrt base URL
 func (o *openwrtClient) getBaseURL() string {
-	return "http://" + o.Ip + "/cgi-bin/luci/"
+	scheme := o.Scheme
+	if scheme == "" {
+		scheme = SchemeHTTP
+	}
+	return scheme + "://" + o.getHost() + "/cgi-bin/luci/"
+}
+
+// getToken returns the session token, and logs in if there is none
+func (o *openwrtClient) getToken(ctx context.Context) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token == "" {
+		token, err := o.login(ctx)
+		if err != nil {
+			return "", err
+		}
+		o.token = token
+	}
+	return o.token, nil
 }
 
-// login to openwrt http server
-func (o *openwrtClient) login() error {
+// resetToken drops an expired token, unless another call has already logged in again
+func (o *openwrtClient) resetToken(token string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token == token {
+		o.token = ""
+	}
+}
+
+// login to openwrt http server and return the session token
+func (o *openwrtClient) login(ctx context.Context) (string, error) {
+	if o.err != nil {
+		return "", o.err
+	}
 	client := &http.Client{
+		Transport: o.transport,
 		// block redirect
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
@@ -84,9 +168,12 @@ func (o *openwrtClient) login() error {
 	}
 
 	// login
-	login_info := "luci_username=" + o.User + "&luci_password=" + o.Password
+	login_info := url.Values{"luci_username": {o.User}, "luci_password": {o.Password}}.Encode()
 	var req_body = []byte(login_info)
-	req, _ := http.NewRequest("POST", o.getBaseURL(), bytes.NewBuffer(req_body))
+	req, err := http.NewRequestWithContext(ctx, "POST", o.getBaseURL(), bytes.NewBuffer(req_body))
+	if err != nil {
+		return "", err
+	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := client.Do(req)
@@ -95,10 +182,13 @@ func (o *openwrtClient) login() error {
 	}
 
 	if err != nil {
-		return err
-	} else if resp.StatusCode != 302 {
+		return "", &TransportError{Err: err}
+	} else if resp.StatusCode >= 500 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", newOpenwrtError(resp.StatusCode, string(body))
+	} else if resp.StatusCode != 302 || len(resp.Header["Set-Cookie"]) == 0 {
 		// fail to auth
-		return &OpenwrtError{Code: resp.StatusCode, Message: "Unauthorized"}
+		return "", newOpenwrtError(http.StatusUnauthorized, "Unauthorized")
 	} else {
 		// get token
 		res_cookie := resp.Header["Set-Cookie"][0]
@@ -114,80 +204,148 @@ func (o *openwrtClient) login() error {
 			}
 
 			if key == "sysauth" {
-				o.token = value
-				break
+				return value, nil
 			}
 		}
 	}
 
-	return nil
+	return "", newOpenwrtError(http.StatusUnauthorized, "Unauthorized: no session token")
 }
 
-// logout to openwrt http server
-func (o *openwrtClient) logout() error {
-	if o.token != "" {
-		_, err := o.Get("admin/logout")
-		o.token = ""
-		return err
+// closeSession logs out the session of a client which is no longer used
+func (o *openwrtClient) closeSession(timeout time.Duration) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
+	o.logout(ctx)
+}
 
-	return nil
+// logout to openwrt http server
+func (o *openwrtClient) logout(ctx context.Context) error {
+	o.mu.Lock()
+	token := o.token
+	o.token = ""
+	o.mu.Unlock()
+	if token == "" {
+		return nil
+	}
+	_, _, err := o.send(ctx, "GET", "admin/logout", "", token)
+	return err
 }
 
-// call openwrt restful API
-func (o *openwrtClient) call(method string, url string, request string) (string, error) {
-	for i := 0; i < 2; i++ {
-		if o.token == "" {
-			err := o.login()
+// call openwrt restful API. The idempotent requests are retried by the retry policy, and
+// all the requests fail fast while the circuit breaker of the server is open.
+func (o *openwrtClient) call(ctx context.Context, method string, url string, request string) (string, error) {
+	endpoint := o.getBaseURL()
+	breaker := getCircuitBreaker(endpoint)
+	retries := 0
+	if isIdempotent(method) {
+		retries = Retry.MaxRetries
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		if !breaker.allow() {
 			if err != nil {
+				// the breaker is opened by the failures of the previous attempts
 				return "", err
 			}
+			return "", &TransportError{Err: ErrCircuitOpen}
+		}
+		var body string
+		body, err = o.callOnce(ctx, method, url, request)
+		if err != nil && ctx.Err() != nil {
+			// the caller gave up, only the timeout of the attempt itself is a failure of the server
+			breaker.cancel()
+			return "", err
+		}
+		breaker.record(err)
+		if err == nil || attempt >= retries || !isRetriable(err) || ctx.Err() != nil {
+			return body, err
+		}
+		requestRetries.WithLabelValues(endpoint, method).Inc()
+		select {
+		case <-time.After(Retry.backoff(attempt)):
+		case <-ctx.Done():
+			return "", err
 		}
+	}
+}
 
-		client := &http.Client{}
-		req_body := bytes.NewBuffer([]byte(request))
-		req, _ := http.NewRequest(method, o.getBaseURL()+url, req_body)
-		req.Header.Add("Cookie", "sysauth="+o.token)
-		resp, err := client.Do(req)
+// callOnce calls openwrt restful API once, with a new login if the token is expired
+func (o *openwrtClient) callOnce(ctx context.Context, method string, url string, request string) (string, error) {
+	if RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, RequestTimeout)
+		defer cancel()
+	}
+	for i := 0; i < 2; i++ {
+		token, err := o.getToken(ctx)
 		if err != nil {
 			return "", err
 		}
-		defer resp.Body.Close()
-
-		body, _ := ioutil.ReadAll(resp.Body)
-		if resp.StatusCode >= 400 {
-			if resp.StatusCode == 403 {
+		body, code, err := o.send(ctx, method, url, request, token)
+		if err != nil {
+			return "", err
+		}
+		if code >= 400 {
+			if code == 403 {
 				// token expired, retry
-				o.token = ""
+				o.resetToken(token)
 				continue
 			} else {
 				// error request
-				return "", &OpenwrtError{Code: resp.StatusCode, Message: string(body)}
+				return "", newOpenwrtError(code, body)
 			}
 		}
 
-		return string(body), nil
+		return body, nil
+	}
+
+	// the session is rejected again after a new login
+	return "", newOpenwrtError(http.StatusForbidden, "Forbidden")
+}
+
+// send sends a request with the session token, and returns the response body and status code
+func (o *openwrtClient) send(ctx context.Context, method string, url string, request string, token string) (string, int, error) {
+	client := &http.Client{Transport: o.transport}
+	req_body := bytes.NewBuffer([]byte(request))
+	req, err := http.NewRequestWithContext(ctx, method, o.getBaseURL()+url, req_body)
+	if err != nil {
+		return "", 0, err
 	}
+	req.Header.Add("Cookie", "sysauth="+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, &TransportError{Err: err}
+	}
+	defer resp.Body.Close()
 
-	return "", nil
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, &TransportError{Err: err}
+	}
+	return string(body), resp.StatusCode, nil
 }
 
 // call openwrt Get restful API
-func (o *openwrtClient) Get(url string) (string, error) {
-	return o.call("GET", url, "")
+func (o *openwrtClient) Get(ctx context.Context, url string) (string, error) {
+	return o.call(ctx, "GET", url, "")
 }
 
 // call openwrt restful API
-func (o *openwrtClient) Post(url string, request string) (string, error) {
-	return o.call("POST", url, request)
+func (o *openwrtClient) Post(ctx context.Context, url string, request string) (string, error) {
+	return o.call(ctx, "POST", url, request)
 }
 
 // call openwrt restful API
-func (o *openwrtClient) Put(url string, request string) (string, error) {
-	return o.call("PUT", url, request)
+func (o *openwrtClient) Put(ctx context.Context, url string, request string) (string, error) {
+	return o.call(ctx, "PUT", url, request)
 }
 
 // call openwrt restful API
-func (o *openwrtClient) Delete(url string) (string, error) {
-	return o.call("DELETE", url, "")
+func (o *openwrtClient) Delete(ctx context.Context, url string) (string, error) {
+	return o.call(ctx, "DELETE", url, "")
 }
@@ -0,0 +1,112 @@
+package openwrt
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeLuci is an openwrt http server which counts the logins and the API requests,
+// and answers the API requests with handler
+type fakeLuci struct {
+	*httptest.Server
+	logins   int32
+	requests int32
+	// the password of the last login
+	password atomic.Value
+}
+
+func newFakeLuci(t *testing.T, handler http.HandlerFunc) *fakeLuci {
+	f := &fakeLuci{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/cgi-bin/luci/" {
+			atomic.AddInt32(&f.logins, 1)
+			f.password.Store(r.PostFormValue("luci_password"))
+			http.SetCookie(w, &http.Cookie{Name: "sysauth", Value: "token", Path: "/"})
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		atomic.AddInt32(&f.requests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeLuci) clientInfo(t *testing.T) OpenwrtClientInfo {
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(f.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return OpenwrtClientInfo{Ip: host, Port: p, User: "root", Password: t.Name()}
+}
+
+func TestConcurrentCallsShareOneLogin(t *testing.T) {
+	f := newFakeLuci(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "policy"}`))
+	})
+	mwan3 := Mwan3Client{OpenwrtClient: GetOpenwrtClient(f.clientInfo(t))}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := mwan3.GetPolicy(context.Background(), "policy"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if f.logins != 1 {
+		t.Errorf("got %d logins, want 1", f.logins)
+	}
+}
+
+func TestLoginEncodesCredentials(t *testing.T) {
+	f := newFakeLuci(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	info := f.clientInfo(t)
+	info.Password = "p&ss=w+rd% 1"
+	if _, err := GetOpenwrtClient(info).Get(context.Background(), "admin/status"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.password.Load(); got != info.Password {
+		t.Errorf("got password %q, want %q", got, info.Password)
+	}
+}
+
+func TestRotatedCredentialsEndOldSession(t *testing.T) {
+	logouts := make(chan struct{}, 1)
+	f := newFakeLuci(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cgi-bin/luci/admin/logout" {
+			logouts <- struct{}{}
+		}
+		w.Write([]byte(`{}`))
+	})
+	info := f.clientInfo(t)
+	old := GetOpenwrtClient(info)
+	if _, err := old.Get(context.Background(), "admin/status"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(info.key(), info.Password) {
+		t.Error("the client key has the password")
+	}
+	info.Password = "rotated"
+	if GetOpenwrtClient(info) == old {
+		t.Fatal("the client with the old password is used")
+	}
+	select {
+	case <-logouts:
+	case <-time.After(5 * time.Second):
+		t.Error("the session with the old password is not logged out")
+	}
+}
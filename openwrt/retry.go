@@ -0,0 +1,194 @@
+package openwrt
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryPolicy retries the idempotent requests (GET, PUT and DELETE) which fail with a
+// server error or a transport error, e.g. a refused connection or a timeout
+type RetryPolicy struct {
+	// the max number of retries of a request, 0 disables the retry
+	MaxRetries int
+	// the backoff before the first retry, which is doubled for every retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+var Retry = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// backoff returns the jittered backoff before a retry, which is between half and all of the
+// exponential backoff, so that the retries to a recovering server are spread
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := r.InitialBackoff
+	for i := 0; i < attempt && backoff < r.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.MaxBackoff {
+		backoff = r.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func isIdempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+}
+
+func isRetriable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return IsServerError(err) || IsTransport(err)
+}
+
+// ErrCircuitOpen fails the requests to a server whose circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// IsCircuitOpen is true if the request was not sent as the circuit breaker of the server is open
+func IsCircuitOpen(err error) bool {
+	return errors.Is(err, ErrCircuitOpen)
+}
+
+// CircuitBreakerPolicy opens the circuit breaker of a server after FailureThreshold consecutive
+// failed requests. The requests fail fast while it is open, and after OpenTimeout one request is
+// let through to probe the server: it closes the breaker if it succeeds, or opens it again.
+type CircuitBreakerPolicy struct {
+	// 0 disables the circuit breaker
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+var CircuitBreaker = CircuitBreakerPolicy{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+}
+
+// The states of a circuit breaker, which are the values of the state metric
+const (
+	circuitClosed   = 0
+	circuitHalfOpen = 1
+	circuitOpen     = 2
+)
+
+type circuitBreaker struct {
+	mu       sync.Mutex
+	endpoint string
+	state    int
+	failures int
+	openedAt time.Time
+	// a probe request is running in half-open state
+	probing bool
+	// the breaker is dropped, so its state is not in the metric anymore
+	evicted bool
+}
+
+var breakers = struct {
+	sync.Mutex
+	endpoints map[string]*circuitBreaker
+}{endpoints: map[string]*circuitBreaker{}}
+
+// getCircuitBreaker returns the circuit breaker of a server, which is shared by all its clients
+func getCircuitBreaker(endpoint string) *circuitBreaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.endpoints[endpoint]
+	if !ok {
+		b = &circuitBreaker{endpoint: endpoint}
+		breakers.endpoints[endpoint] = b
+		circuitBreakerState.WithLabelValues(endpoint).Set(circuitClosed)
+	}
+	return b
+}
+
+// retainCircuitBreakers drops the circuit breakers and the metrics of the servers not in endpoints
+func retainCircuitBreakers(endpoints map[string]bool) {
+	breakers.Lock()
+	defer breakers.Unlock()
+	for endpoint, b := range breakers.endpoints {
+		if endpoints[endpoint] {
+			continue
+		}
+		delete(breakers.endpoints, endpoint)
+		b.mu.Lock()
+		b.evicted = true
+		b.mu.Unlock()
+		circuitBreakerState.DeleteLabelValues(endpoint)
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			requestRetries.DeleteLabelValues(endpoint, method)
+		}
+	}
+}
+
+func (b *circuitBreaker) setState(state int) {
+	if b.state != state {
+		b.state = state
+		if !b.evicted {
+			circuitBreakerState.WithLabelValues(b.endpoint).Set(float64(state))
+		}
+	}
+}
+
+// allow checks if a request can be sent to the server
+func (b *circuitBreaker) allow() bool {
+	if CircuitBreaker.FailureThreshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < CircuitBreaker.OpenTimeout {
+			return false
+		}
+		b.setState(circuitHalfOpen)
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// cancel ends a request without a result, as it was cancelled by the caller, which says
+// nothing about the server
+func (b *circuitBreaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record counts the result of a request. A response other than a server error shows that
+// the server is alive.
+func (b *circuitBreaker) record(err error) {
+	if CircuitBreaker.FailureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !IsServerError(err) && !IsTransport(err) {
+		b.failures = 0
+		b.setState(circuitClosed)
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= CircuitBreaker.FailureThreshold {
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+	}
+}
@@ -0,0 +1,224 @@
+package openwrt
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// setPolicies sets the retry and circuit breaker policies for a test, with short backoffs
+func setPolicies(t *testing.T, retries int, failureThreshold int, openTimeout time.Duration) {
+	oldRetry, oldBreaker, oldTimeout := Retry, CircuitBreaker, RequestTimeout
+	Retry = RetryPolicy{MaxRetries: retries, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	CircuitBreaker = CircuitBreakerPolicy{FailureThreshold: failureThreshold, OpenTimeout: openTimeout}
+	t.Cleanup(func() {
+		Retry, CircuitBreaker, RequestTimeout = oldRetry, oldBreaker, oldTimeout
+	})
+}
+
+// failingHandler answers the first failures requests with status, and the others with 200
+func failingHandler(failures int32, status int) http.HandlerFunc {
+	var count int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	setPolicies(t, 3, 0, 0)
+	tests := []struct {
+		name     string
+		method   string
+		failures int32
+		status   int
+		// the requests the server gets
+		wantRequests int32
+		wantErr      bool
+	}{
+		{name: "GET is retried", method: http.MethodGet, failures: 2, status: http.StatusServiceUnavailable, wantRequests: 3},
+		{name: "PUT is retried", method: http.MethodPut, failures: 2, status: http.StatusBadGateway, wantRequests: 3},
+		{name: "DELETE is retried", method: http.MethodDelete, failures: 2, status: http.StatusInternalServerError, wantRequests: 3},
+		{name: "POST is not retried", method: http.MethodPost, failures: 2, status: http.StatusServiceUnavailable, wantRequests: 1, wantErr: true},
+		{name: "retries are limited", method: http.MethodGet, failures: 10, status: http.StatusServiceUnavailable, wantRequests: 4, wantErr: true},
+		{name: "client errors are not retried", method: http.MethodGet, failures: 10, status: http.StatusNotFound, wantRequests: 1, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeLuci(t, failingHandler(test.failures, test.status))
+			_, err := GetOpenwrtClient(f.clientInfo(t)).call(context.Background(), test.method, "sdewan/v1/test", "")
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+			if requests := atomic.LoadInt32(&f.requests); requests != test.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryTransportError(t *testing.T) {
+	setPolicies(t, 3, 0, 0)
+	tests := []struct {
+		method      string
+		wantRetries float64
+	}{
+		{method: http.MethodGet, wantRetries: 3},
+		{method: http.MethodPost, wantRetries: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			f := newFakeLuci(t, failingHandler(0, 0))
+			client := GetOpenwrtClient(f.clientInfo(t))
+			// the connections are refused
+			f.Close()
+			_, err := client.call(context.Background(), test.method, "sdewan/v1/test", "")
+			if !IsTransport(err) {
+				t.Errorf("got error %v, want a transport error", err)
+			}
+			retries := testutil.ToFloat64(requestRetries.WithLabelValues(client.getBaseURL(), test.method))
+			if retries != test.wantRetries {
+				t.Errorf("got %v retries, want %v", retries, test.wantRetries)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	setPolicies(t, 0, 2, 50*time.Millisecond)
+	type step struct {
+		// the status of the server, and the time to wait before the request
+		status int
+		wait   time.Duration
+		// whether the request reaches the server
+		wantSent  bool
+		wantErr   bool
+		wantState float64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after the failures, and closes after a successful probe",
+			steps: []step{
+				{status: http.StatusServiceUnavailable, wantSent: true, wantErr: true, wantState: circuitClosed},
+				{status: http.StatusServiceUnavailable, wantSent: true, wantErr: true, wantState: circuitOpen},
+				{status: http.StatusOK, wantSent: false, wantErr: true, wantState: circuitOpen},
+				{status: http.StatusOK, wait: 60 * time.Millisecond, wantSent: true, wantState: circuitClosed},
+				{status: http.StatusServiceUnavailable, wantSent: true, wantErr: true, wantState: circuitClosed},
+			},
+		},
+		{
+			name: "opens again after a failed probe",
+			steps: []step{
+				{status: http.StatusServiceUnavailable, wantSent: true, wantErr: true, wantState: circuitClosed},
+				{status: http.StatusServiceUnavailable, wantSent: true, wantErr: true, wantState: circuitOpen},
+				{status: http.StatusServiceUnavailable, wait: 60 * time.Millisecond, wantSent: true, wantErr: true, wantState: circuitOpen},
+				{status: http.StatusOK, wantSent: false, wantErr: true, wantState: circuitOpen},
+			},
+		},
+		{
+			name: "a response other than a server error resets the failures",
+			steps: []step{
+				{status: http.StatusServiceUnavailable, wantSent: true, wantErr: true, wantState: circuitClosed},
+				{status: http.StatusNotFound, wantSent: true, wantErr: true, wantState: circuitClosed},
+				{status: http.StatusServiceUnavailable, wantSent: true, wantErr: true, wantState: circuitClosed},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var status int32
+			f := newFakeLuci(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(int(atomic.LoadInt32(&status)))
+			})
+			client := GetOpenwrtClient(f.clientInfo(t))
+			for i, step := range test.steps {
+				atomic.StoreInt32(&status, int32(step.status))
+				time.Sleep(step.wait)
+				requests := atomic.LoadInt32(&f.requests)
+				_, err := client.Get(context.Background(), "sdewan/v1/test")
+				if sent := atomic.LoadInt32(&f.requests) != requests; sent != step.wantSent {
+					t.Errorf("step %d: got request sent %v, want %v", i, sent, step.wantSent)
+				}
+				if (err != nil) != step.wantErr {
+					t.Errorf("step %d: got error %v, want error %v", i, err, step.wantErr)
+				}
+				if !step.wantSent && !IsCircuitOpen(err) {
+					t.Errorf("step %d: got error %v, want circuit open", i, err)
+				}
+				state := testutil.ToFloat64(circuitBreakerState.WithLabelValues(client.getBaseURL()))
+				if state != step.wantState {
+					t.Errorf("step %d: got state %v, want %v", i, state, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresCallerTimeout(t *testing.T) {
+	setPolicies(t, 0, 1, time.Minute)
+	tests := []struct {
+		name           string
+		callerTimeout  time.Duration
+		requestTimeout time.Duration
+		wantState      float64
+	}{
+		{name: "the caller gives up", callerTimeout: 20 * time.Millisecond, requestTimeout: time.Minute, wantState: circuitClosed},
+		{name: "the request times out", callerTimeout: time.Minute, requestTimeout: 20 * time.Millisecond, wantState: circuitOpen},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			RequestTimeout = test.requestTimeout
+			f := newFakeLuci(t, func(w http.ResponseWriter, r *http.Request) {
+				// a hung server
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			})
+			client := GetOpenwrtClient(f.clientInfo(t))
+			ctx, cancel := context.WithTimeout(context.Background(), test.callerTimeout)
+			defer cancel()
+			if _, err := client.Get(ctx, "sdewan/v1/test"); err == nil {
+				t.Fatal("got no error")
+			}
+			state := testutil.ToFloat64(circuitBreakerState.WithLabelValues(client.getBaseURL()))
+			if state != test.wantState {
+				t.Errorf("got state %v, want %v", state, test.wantState)
+			}
+		})
+	}
+}
+
+func TestIdleClientsAreDropped(t *testing.T) {
+	old := ClientIdleTimeout
+	ClientIdleTimeout = 20 * time.Millisecond
+	t.Cleanup(func() {
+		ClientIdleTimeout = old
+	})
+	f := newFakeLuci(t, failingHandler(0, 0))
+	idle := GetOpenwrtClient(f.clientInfo(t))
+	if _, err := idle.Get(context.Background(), "sdewan/v1/test"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	GetOpenwrtClient(OpenwrtClientInfo{Ip: "192.0.2.1"})
+	if GetOpenwrtClient(f.clientInfo(t)) == idle {
+		t.Error("the idle client is still cached")
+	}
+	breakers.Lock()
+	_, ok := breakers.endpoints[idle.getBaseURL()]
+	breakers.Unlock()
+	if ok {
+		t.Error("the circuit breaker of the idle client is kept")
+	}
+}
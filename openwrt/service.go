@@ -1,6 +1,7 @@
 package openwrt
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -20,8 +21,8 @@ type AvailableServices struct {
 }
 
 // get available services
-func (s *ServiceClient) GetAvailableServices() (*AvailableServices, error) {
-	response, err := s.OpenwrtClient.Get(serviceBaseURL + "services")
+func (s *ServiceClient) GetAvailableServices(ctx context.Context) (*AvailableServices, error) {
+	response, err := s.OpenwrtClient.Get(ctx, serviceBaseURL+"services")
 	if err != nil {
 		return nil, err
 	}
@@ -35,20 +36,110 @@ func (s *ServiceClient) GetAvailableServices() (*AvailableServices, error) {
 	return &servs, nil
 }
 
+// The actions supported by the services of a CNF, e.g. {"services": {"mwan3": ["reload", "restart"]}}
+type ServiceActions struct {
+	Services ServiceCapabilities `json:"services"`
+}
+
+// GetServiceCapabilities gets the actions supported by the services of the CNF. They are asked once
+// per client, and a CNF without the API gets DefaultServiceCapabilities. Other errors are not kept,
+// so the next call asks the CNF again.
+func (s *ServiceClient) GetServiceCapabilities(ctx context.Context) (ServiceCapabilities, error) {
+	o := s.OpenwrtClient
+	// the concurrent changes to the pod wait for one request
+	o.capabilitiesMu.Lock()
+	defer o.capabilitiesMu.Unlock()
+	if o.capabilities != nil {
+		return o.capabilities, nil
+	}
+	response, err := o.Get(ctx, serviceBaseURL+"services/actions")
+	if IsNotFound(err) {
+		o.capabilities = DefaultServiceCapabilities
+		return o.capabilities, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var actions ServiceActions
+	err = json.Unmarshal([]byte(response), &actions)
+	if err != nil {
+		return nil, err
+	}
+	o.capabilities = ServiceCapabilities{}
+	for service, supported := range actions.Services {
+		o.capabilities[service] = supported
+	}
+	return o.capabilities, nil
+}
+
 func (s *ServiceClient) formatExecuteServiceBody(operation string) string {
 	return "{\"action\":\"" + operation + "\"}"
 }
 
 // execute operation on service
-func (s *ServiceClient) ExecuteService(service string, operation string) (bool, error) {
+func (s *ServiceClient) ExecuteService(ctx context.Context, service string, operation string) (bool, error) {
 	if !IsContained(available_Services, service) {
 		return false, &OpenwrtError{Code: 400, Message: "Bad Request: not supported service(" + service + ")"}
 	}
 
-	_, err := s.OpenwrtClient.Put(serviceBaseURL+"services/"+service, s.formatExecuteServiceBody(operation))
+	_, err := s.OpenwrtClient.Put(ctx, serviceBaseURL+"services/"+service, s.formatExecuteServiceBody(operation))
 	if err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
+
+// Service actions
+const (
+	ServiceActionReload  = "reload"
+	ServiceActionRestart = "restart"
+	ServiceActionStart   = "start"
+	ServiceActionStop    = "stop"
+)
+
+// the disruption of the actions to the running service, the lower the better
+var serviceActionRanks = map[string]int{
+	ServiceActionReload:  0,
+	ServiceActionRestart: 1,
+	ServiceActionStart:   2,
+	ServiceActionStop:    2,
+}
+
+// ServiceCapabilities records the actions supported by each service of a CNF
+type ServiceCapabilities map[string][]string
+
+// DefaultServiceCapabilities are the actions supported by the openwrt init scripts of the services,
+// for the CNFs which don't report the actions of their services
+var DefaultServiceCapabilities = ServiceCapabilities{
+	"mwan3":    {ServiceActionReload, ServiceActionRestart, ServiceActionStart, ServiceActionStop},
+	"firewall": {ServiceActionReload, ServiceActionRestart, ServiceActionStart, ServiceActionStop},
+	"ipsec":    {ServiceActionReload, ServiceActionRestart, ServiceActionStart, ServiceActionStop},
+}
+
+// SelectAction returns the least disruptive action of candidates supported by the service
+func (c ServiceCapabilities) SelectAction(service string, candidates []string) (string, error) {
+	supported, ok := c[service]
+	if !ok {
+		return "", &OpenwrtError{Code: 400, Message: "Bad Request: not supported service(" + service + ")"}
+	}
+	action := ""
+	for _, candidate := range candidates {
+		if !IsContained(supported, candidate) {
+			continue
+		}
+		if action == "" || CompareServiceActions(candidate, action) < 0 {
+			action = candidate
+		}
+	}
+	if action == "" {
+		return "", &OpenwrtError{Code: 400, Message: "Bad Request: no supported action for service(" + service + ")"}
+	}
+	return action, nil
+}
+
+// CompareServiceActions returns a negative number if action1 is less disruptive than action2,
+// a positive number if it is more disruptive, and 0 if they are the same
+func CompareServiceActions(action1 string, action2 string) int {
+	return serviceActionRanks[action1] - serviceActionRanks[action2]
+}
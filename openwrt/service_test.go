@@ -0,0 +1,74 @@
+package openwrt
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetServiceCapabilities(t *testing.T) {
+	candidates := []string{ServiceActionReload, ServiceActionRestart}
+	tests := []struct {
+		name string
+		// the response of the CNF to the actions API, 404 if empty
+		response   string
+		wantAction string
+	}{
+		{name: "restart only", response: `{"services": {"mwan3": ["restart", "start", "stop"]}}`, wantAction: ServiceActionRestart},
+		{name: "reload", response: `{"services": {"mwan3": ["reload", "restart"]}}`, wantAction: ServiceActionReload},
+		{name: "no actions API", wantAction: ServiceActionReload},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var asked int32
+			f := newFakeLuci(t, func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/sdewan/v1/services/actions") {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				atomic.AddInt32(&asked, 1)
+				if test.response == "" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(test.response))
+			})
+			service := ServiceClient{OpenwrtClient: GetOpenwrtClient(f.clientInfo(t))}
+			for i := 0; i < 2; i++ {
+				capabilities, err := service.GetServiceCapabilities(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				action, err := capabilities.SelectAction("mwan3", candidates)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if action != test.wantAction {
+					t.Errorf("got action %s, want %s", action, test.wantAction)
+				}
+			}
+			if asked := atomic.LoadInt32(&asked); asked != 1 {
+				t.Errorf("the CNF is asked %d times, want once", asked)
+			}
+		})
+	}
+}
+
+func TestGetServiceCapabilitiesRetriesErrors(t *testing.T) {
+	setPolicies(t, 0, 0, 0)
+	f := newFakeLuci(t, failingHandler(1, http.StatusInternalServerError))
+	service := ServiceClient{OpenwrtClient: GetOpenwrtClient(f.clientInfo(t))}
+	if _, err := service.GetServiceCapabilities(context.Background()); !IsServerError(err) {
+		t.Fatalf("got error %v, want a server error", err)
+	}
+	// the static table is only used for a CNF without the API
+	capabilities, err := service.GetServiceCapabilities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(capabilities) != 0 {
+		t.Errorf("got capabilities %v, want the ones reported by the CNF", capabilities)
+	}
+}
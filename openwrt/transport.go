@@ -0,0 +1,171 @@
+package openwrt
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+)
+
+// TLSConfig is the TLS setting to access the openwrt http server with https
+type TLSConfig struct {
+	// PEM bundle of the CAs to verify the server certificate, the system CAs are used if empty
+	CA []byte
+	// PEM client certificate and key, optional
+	Cert []byte
+	Key  []byte
+	// the name to verify the server certificate with, the IP of the server if empty
+	ServerName string
+	// skip the verification of the server certificate, for lab use only
+	InsecureSkipVerify bool
+}
+
+// hash identifies a TLS setting in the key of the cached clients
+func (t *TLSConfig) hash() string {
+	if t == nil {
+		return ""
+	}
+	h := sha256.New()
+	for _, b := range [][]byte{t.CA, t.Cert, t.Key, []byte(t.ServerName), []byte(strconv.FormatBool(t.InsecureSkipVerify))} {
+		h.Write([]byte(strconv.Itoa(len(b))))
+		h.Write(b)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func (t *TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if len(t.CA) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(t.CA) {
+			return nil, errors.New("No valid certificate in the CA bundle")
+		}
+		config.RootCAs = pool
+	}
+	if len(t.Cert) > 0 || len(t.Key) > 0 {
+		cert, err := tls.X509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// TransportOptions tunes the connections to the openwrt http servers
+type TransportOptions struct {
+	// the timeout to connect to a server
+	DialTimeout time.Duration
+	// the keep-alive period of the connections
+	KeepAlive time.Duration
+	// the max number of idle connections, in total and to one server
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// how long an idle connection is kept
+	IdleConnTimeout     time.Duration
+	TLSHandshakeTimeout time.Duration
+}
+
+var DefaultTransportOptions = TransportOptions{
+	DialTimeout:         10 * time.Second,
+	KeepAlive:           30 * time.Second,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 2,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// RequestTimeout is the timeout of a request to an openwrt http server, including the login
+// and the response body. 0 means no timeout other than the deadline of the request context.
+var RequestTimeout = 10 * time.Second
+
+// the transports shared by the clients, the http one and one per TLS setting
+var transports = struct {
+	sync.Mutex
+	options TransportOptions
+	http    *http.Transport
+	https   map[string]*http.Transport
+}{options: DefaultTransportOptions, https: map[string]*http.Transport{}}
+
+// SetTransportOptions sets the options of the shared transports. It is supposed to be called
+// before any client is created.
+func SetTransportOptions(options TransportOptions) {
+	transports.Lock()
+	defer transports.Unlock()
+	transports.options = options
+	transports.http = nil
+	transports.https = map[string]*http.Transport{}
+}
+
+func (options TransportOptions) newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   options.DialTimeout,
+			KeepAlive: options.KeepAlive,
+		}).DialContext,
+		MaxIdleConns:        options.MaxIdleConns,
+		MaxIdleConnsPerHost: options.MaxIdleConnsPerHost,
+		IdleConnTimeout:     options.IdleConnTimeout,
+		TLSHandshakeTimeout: options.TLSHandshakeTimeout,
+	}
+}
+
+// newTransport returns the shared transport to the openwrt http server of the client info
+func newTransport(clientInfo OpenwrtClientInfo) (http.RoundTripper, error) {
+	switch clientInfo.Scheme {
+	case "", SchemeHTTP:
+		transports.Lock()
+		defer transports.Unlock()
+		if transports.http == nil {
+			transports.http = transports.options.newTransport()
+		}
+		return transports.http, nil
+	case SchemeHTTPS:
+	default:
+		return nil, fmt.Errorf("Unsupported scheme %s", clientInfo.Scheme)
+	}
+	tlsInfo := clientInfo.TLS
+	if tlsInfo == nil {
+		tlsInfo = &TLSConfig{}
+	}
+	transports.Lock()
+	defer transports.Unlock()
+	key := tlsInfo.hash()
+	if transport, ok := transports.https[key]; ok {
+		return transport, nil
+	}
+	tlsConfig, err := tlsInfo.build()
+	if err != nil {
+		return nil, err
+	}
+	transport := transports.options.newTransport()
+	transport.TLSClientConfig = tlsConfig
+	transports.https[key] = transport
+	return transport, nil
+}
+
+// the host of the openwrt http server, with the port if it's not the default one of the scheme
+func (c *OpenwrtClientInfo) getHost() string {
+	if c.Port != 0 {
+		return net.JoinHostPort(c.Ip, strconv.Itoa(c.Port))
+	}
+	if net.ParseIP(c.Ip) != nil && net.ParseIP(c.Ip).To4() == nil {
+		return "[" + c.Ip + "]"
+	}
+	return c.Ip
+}